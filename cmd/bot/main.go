@@ -5,113 +5,53 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
-	"time"
 
+	"github.com/C4T-BuT-S4D/shpaga/internal/app"
 	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/health"
 	"github.com/C4T-BuT-S4D/shpaga/internal/logging"
-	"github.com/C4T-BuT-S4D/shpaga/internal/monitor"
-	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
-	"gopkg.in/telebot.v4"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 func main() {
-	setupConfig()
+	app.SetupBotConfig()
+	config.SetupCommon()
 	logging.Init()
 
 	cfg := config.New()
 	logrus.Debugf("config: %+v", cfg)
 
-	db, err := gorm.Open(postgres.Open(cfg.PostgresDSN), &gorm.Config{})
-	if err != nil {
-		logrus.Fatalf("Failed to connect to database: %v", err)
+	if cfg.OAuthStateSecret == "" {
+		logrus.Fatal("oauth_state_secret is not set")
 	}
 
-	store := storage.New(db)
-
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
-	initCtx, migrateCancel := context.WithTimeout(ctx, 10*time.Second)
-	defer migrateCancel()
-
-	if err := store.Migrate(initCtx); err != nil {
-		logrus.Fatalf("Failed to migrate database: %v", err)
-	}
-
-	globalState, err := store.GetOrCreateGlobalState(ctx)
+	store, err := app.OpenStorage(ctx, cfg)
 	if err != nil {
-		logrus.Fatalf("Failed to get or create global state: %v", err)
+		logrus.Fatalf("Failed to open storage: %v", err)
 	}
 
-	bot, err := telebot.NewBot(telebot.Settings{
-		Token: cfg.TelegramToken,
-		Poller: &telebot.LongPoller{
-			Timeout:      10 * time.Second,
-			LastUpdateID: globalState.LastUpdateID,
-			AllowedUpdates: []string{
-				"message",
-				"chat_member",
-				"my_chat_member",
-				"callback_query",
-			},
-		},
-	})
+	bot, err := app.NewBot(ctx, cfg, store)
 	if err != nil {
 		logrus.Fatalf("Failed to create bot: %v", err)
 	}
 
-	mon := monitor.New(cfg, store, bot)
-
-	for _, updateType := range []string{
-		telebot.OnText,
-		telebot.OnForward,
-		telebot.OnMedia,
-		telebot.OnUserJoined,
-		telebot.OnUserLeft,
-		telebot.OnChatMember,
-		telebot.OnMyChatMember,
-		telebot.OnCallback,
-	} {
-		bot.Handle(updateType, mon.HandleAnyUpdate)
-	}
-
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		bot.Start()
+		bot.Run(ctx)
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		mon.RunCleaner(ctx)
+		if err := app.NewOpsServer(cfg.OpsListen, health.NewChecker(store, bot.Telegram(), cfg.HealthMaxUpdateAge)).Run(ctx); err != nil {
+			logrus.Errorf("Ops server failed: %v", err)
+		}
 	}()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		mon.RunUpdateChatAdmins(ctx)
-	}()
-
-	<-ctx.Done()
-
-	bot.Stop()
-
-	logrus.Info("waiting for services to finish")
 	wg.Wait()
 }
-
-func setupConfig() {
-	viper.SetDefault("bot_handle_timeout", "10s")
-	viper.SetDefault("join_login_timeout", "10m")
-
-	viper.SetDefault("cleaner_interval", "15s")
-	viper.SetDefault("chat_syncer_interval", "1m")
-
-	config.SetupCommon()
-}
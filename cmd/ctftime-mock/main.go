@@ -0,0 +1,51 @@
+// Command ctftime-mock runs a stand-in CTFTime OAuth provider for development.
+// Point the bot to it with SHPAGA_CTFTIME_OAUTH_URL=http://localhost:8090.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/logging"
+	"github.com/C4T-BuT-S4D/shpaga/internal/oauthmock"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	listen := flag.String("listen", ":8090", "address to listen on")
+	clientID := flag.String("client-id", "", "expected client id, any if empty")
+	clientSecret := flag.String("client-secret", "", "expected client secret, any if empty")
+	flag.Parse()
+
+	logging.Init()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           oauthmock.New(*clientID, *clientSecret).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logrus.Infof("serving mock CTFTime OAuth on %s", *listen)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Fatalf("failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logrus.Errorf("failed to shutdown server: %v", err)
+	}
+}
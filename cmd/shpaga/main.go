@@ -0,0 +1,85 @@
+// Command shpaga runs the bot and the API in a single process.
+//
+// Usage:
+//
+//	shpaga                         run the bot and the API
+//	shpaga migrate status|up|down  manage the database schema
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/app"
+	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/health"
+	"github.com/C4T-BuT-S4D/shpaga/internal/logging"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	app.SetupBotConfig()
+	app.SetupAPIConfig()
+	config.SetupCommon()
+	logging.Init()
+
+	cfg := config.New()
+	logrus.Debugf("config: %+v", cfg)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(ctx, cfg, os.Args[2:])
+			return
+		default:
+			logrus.Fatalf("unknown command %q", os.Args[1])
+		}
+	}
+
+	if cfg.OAuthStateSecret == "" {
+		logrus.Fatal("oauth_state_secret is not set")
+	}
+
+	store, err := app.OpenStorage(ctx, cfg)
+	if err != nil {
+		logrus.Fatalf("Failed to open storage: %v", err)
+	}
+
+	bot, err := app.NewBot(ctx, cfg, store)
+	if err != nil {
+		logrus.Fatalf("Failed to create bot: %v", err)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bot.Run(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := app.NewAPI(cfg, store, bot.Telegram()).Run(ctx); err != nil {
+			logrus.Errorf("API failed: %v", err)
+			// Take the bot down too, so the process is restarted as a whole.
+			cancel()
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := app.NewOpsServer(cfg.OpsListen, health.NewChecker(store, bot.Telegram(), cfg.HealthMaxUpdateAge)).Run(ctx); err != nil {
+			logrus.Errorf("Ops server failed: %v", err)
+		}
+	}()
+
+	wg.Wait()
+}
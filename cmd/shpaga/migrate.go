@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/app"
+	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) {
+	if len(args) != 1 {
+		logrus.Fatal("usage: shpaga migrate status|up|down")
+	}
+
+	store, err := app.ConnectStorage(cfg)
+	if err != nil {
+		logrus.Fatalf("Failed to connect to storage: %v", err)
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := store.MigrationsStatus(ctx)
+		if err != nil {
+			logrus.Fatalf("Failed to get migrations status: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		if err := w.Flush(); err != nil {
+			logrus.Fatalf("Failed to print status: %v", err)
+		}
+
+	case "up":
+		applied, err := store.MigrateUp(ctx)
+		if err != nil {
+			logrus.Fatalf("Failed to apply migrations: %v", err)
+		}
+		if len(applied) == 0 {
+			logrus.Info("schema is up to date")
+		}
+		for _, status := range applied {
+			logrus.Infof("applied migration %04d_%s", status.Version, status.Name)
+		}
+
+	case "down":
+		reverted, err := store.MigrateDown(ctx)
+		if errors.Is(err, storage.ErrNothingToRollBack) {
+			logrus.Info("no migrations are applied")
+			return
+		}
+		if err != nil {
+			logrus.Fatalf("Failed to roll back migration: %v", err)
+		}
+		logrus.Infof("rolled back migration %04d_%s", reverted.Version, reverted.Name)
+
+	default:
+		logrus.Fatalf("unknown migrate command %q", args[0])
+	}
+}
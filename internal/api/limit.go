@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// notifyAccountLimit tells the admins of the chat which Telegram accounts the CTFTime account has verified,
+// admins who never started the bot can't be reached.
+// The admins are told about each rejected Telegram account once, however many times it logs in.
+func (s *Service) notifyAccountLimit(
+	ctx context.Context,
+	chatState *models.ChatState,
+	user *models.User,
+	profile models.CTFTimeProfile,
+	others []*models.User,
+	logger *logrus.Entry,
+) {
+	added, err := s.storage.AddAccountLimitNotice(ctx, &models.AccountLimitNotice{
+		ChatID:        chatState.ChatID,
+		CTFTimeUserID: profile.UserID,
+		TelegramID:    user.TelegramID,
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to save account limit notice")
+		return
+	}
+	if !added {
+		logger.Debug("admins were already notified about the account")
+		return
+	}
+
+	settings := chatState.EffectiveSettings(s.config.ChatDefaults())
+	lang := i18n.ParseOr(settings.Language, i18n.ParseOr(s.config.Language, i18n.Default))
+
+	title := strconv.FormatInt(chatState.ChatID, 10)
+	if chat, err := s.bot.ChatByID(chatState.ChatID); err != nil {
+		logger.WithError(err).Debug("failed to get chat")
+	} else if chat.Title != "" {
+		title = chat.Title
+	}
+
+	verified := make([]string, 0, len(others))
+	for _, other := range others {
+		verified = append(verified, other.TelegramIdentity())
+	}
+
+	text := lang.T(
+		i18n.AccountLimitExceeded,
+		title,
+		profile.Identity(),
+		user.TelegramIdentity(),
+		strings.Join(verified, ", "),
+		settings.CTFTimeAccountLimit,
+	)
+
+	for _, admin := range chatState.Admins {
+		if admin.User == nil || admin.User.IsBot {
+			continue
+		}
+		if _, err := s.bot.Send(admin.User, text, telebot.NoPreview); err != nil {
+			logger.WithError(err).Debugf("failed to notify admin %v", admin.User.ID)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+
+	"github.com/labstack/echo/v4"
+)
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 4em auto; padding: 0 1em; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p>{{ .Text }}</p>
+</body>
+</html>
+`))
+
+// renderPage renders the page in the language preferred by the browser.
+func (s *Service) renderPage(c echo.Context, status int, title, text i18n.Key) error {
+	lang := i18n.FromAcceptLanguage(
+		c.Request().Header.Get("Accept-Language"),
+		i18n.ParseOr(s.config.Language, i18n.Default),
+	)
+
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, struct {
+		Lang  i18n.Lang
+		Title string
+		Text  string
+	}{
+		Lang:  lang,
+		Title: lang.T(title),
+		Text:  lang.T(text),
+	}); err != nil {
+		return fmt.Errorf("rendering page: %w", err)
+	}
+	return c.HTMLBlob(status, buf.Bytes())
+}
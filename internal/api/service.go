@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/C4T-BuT-S4D/shpaga/internal/authutil"
 	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
 	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgutil"
 	"github.com/go-resty/resty/v2"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
@@ -15,18 +22,18 @@ import (
 
 type Service struct {
 	config  *config.Config
-	storage *storage.Storage
+	storage storage.Storage
 	bot     telebot.API
 
 	client *resty.Client
 }
 
-func NewService(cfg *config.Config, storage *storage.Storage, bot telebot.API) *Service {
+func NewService(cfg *config.Config, storage storage.Storage, bot telebot.API) *Service {
 	return &Service{
 		config:  cfg,
 		storage: storage,
 		bot:     bot,
-		client:  resty.New().SetBaseURL(fmt.Sprintf("https://%s", cfg.CTFTimeOAuthHost)),
+		client:  resty.New().SetBaseURL(cfg.CTFTimeOAuthBaseURL()),
 	}
 }
 
@@ -34,81 +41,189 @@ func (s *Service) HandleOAuthCallback() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		code := c.QueryParam("code")
 		if code == "" {
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "code is required"})
+			metrics.OAuthFailures.WithLabelValues("code").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageInvalidLinkTitle, i18n.PageCodeMissing)
 		}
 
 		stateRaw := c.QueryParam("state")
 		if stateRaw == "" {
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "state is required"})
+			metrics.OAuthFailures.WithLabelValues("state").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageInvalidLinkTitle, i18n.PageStateMissing)
 		}
 
-		state, err := authutil.StateFromString(stateRaw)
-		if err != nil {
+		state, err := authutil.StateFromString(stateRaw, s.config)
+		switch {
+		case errors.Is(err, authutil.ErrStateExpired):
+			logrus.WithError(err).Warn("received expired state")
+			metrics.OAuthFailures.WithLabelValues("state_expired").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageLinkExpiredTitle, i18n.PageLinkExpired)
+		case errors.Is(err, authutil.ErrStateInvalidSignature):
+			logrus.WithError(err).Warn("received state with invalid signature")
+			metrics.OAuthFailures.WithLabelValues("state_signature").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageInvalidLinkTitle, i18n.PageLinkInvalid)
+		case err != nil:
 			logrus.WithError(err).Error("failed to unmarshal state")
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "failed to unmarshal state"})
+			metrics.OAuthFailures.WithLabelValues("state_malformed").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageInvalidLinkTitle, i18n.PageLinkMalformed)
 		}
 
 		logger := logrus.WithFields(logrus.Fields{
 			"chat_id": state.ChatID,
 			"user_id": state.UserID,
+			"nonce":   state.Nonce,
 		})
 
+		storedState, err := s.storage.ConsumeOAuthState(c.Request().Context(), state.Nonce)
+		switch {
+		case errors.Is(err, storage.ErrOAuthStateUsed):
+			logger.WithError(err).Warn("received replayed state")
+			metrics.OAuthFailures.WithLabelValues("state_replayed").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageLinkUsedTitle, i18n.PageLinkUsed)
+		case err != nil:
+			logger.WithError(err).Error("failed to consume state")
+			metrics.OAuthFailures.WithLabelValues("state_consume").Inc()
+			return s.renderPage(c, http.StatusInternalServerError, i18n.PageErrorTitle, i18n.PageVerifyFailed)
+		}
+
+		if storedState.UserID != state.UserID {
+			logger.Errorf("state user mismatch, stored state: %v", storedState)
+			metrics.OAuthFailures.WithLabelValues("state_user_mismatch").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageInvalidLinkTitle, i18n.PageLinkInvalid)
+		}
+
 		user, err := s.storage.GetUser(c.Request().Context(), state.UserID)
 		if err != nil {
 			logger.WithError(err).Error("failed to get user")
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to get user"})
+			metrics.OAuthFailures.WithLabelValues("user").Inc()
+			return s.renderPage(c, http.StatusInternalServerError, i18n.PageErrorTitle, i18n.PageUserFailed)
 		}
 
 		logger.Info("received oauth callback")
 
-		token, err := s.getOAuthToken(code)
+		if s.config.CTFTimePKCE && storedState.CodeVerifier == "" {
+			logger.Warn("pkce is enabled, but state has no code verifier")
+			metrics.OAuthFailures.WithLabelValues("state_verifier").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageInvalidLinkTitle, i18n.PageLinkInvalid)
+		}
+
+		token, err := s.getOAuthToken(code, storedState.CodeVerifier)
 		if err != nil {
 			logger.WithError(err).Error("failed to get oauth token")
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to get oauth token"})
+			metrics.OAuthFailures.WithLabelValues("token").Inc()
+			return s.renderPage(c, http.StatusInternalServerError, i18n.PageErrorTitle, i18n.PageTokenFailed)
 		}
 
 		logger.Info("received oauth token")
 
-		ctftimeUserID, err := s.getUser(token)
+		profile, err := s.getUser(token)
 		if err != nil {
-			logger.WithError(err).Error("failed to get ctftime user id")
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to get user"})
+			logger.WithError(err).Error("failed to get ctftime user")
+			metrics.OAuthFailures.WithLabelValues("ctftime_user").Inc()
+			return s.renderPage(c, http.StatusInternalServerError, i18n.PageErrorTitle, i18n.PageCTFTimeUserFailed)
 		}
 
-		logger = logger.WithField("ctftime_user_id", ctftimeUserID)
+		logger = logger.WithField("ctftime_user_id", profile.UserID)
 		logger.Info("resolved CTFTime user")
 
-		if err := s.storage.OnUserAuthorized(c.Request().Context(), state.UserID, ctftimeUserID); err != nil {
-			logger.WithError(err).Error("failed to set oauth token")
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to set oauth token"})
+		chatState, err := s.storage.GetChatState(c.Request().Context(), user.ChatID)
+		if err != nil {
+			logger.WithError(err).Error("failed to get chat state")
+			metrics.OAuthFailures.WithLabelValues("chat").Inc()
+			return s.renderPage(c, http.StatusInternalServerError, i18n.PageErrorTitle, i18n.PageSaveFailed)
 		}
 
-		logger.Info("successfully set oauth token")
+		lang := i18n.ParseOr(state.Lang, i18n.ParseOr(s.config.Language, i18n.Default))
+		limit := chatState.EffectiveSettings(s.config.ChatDefaults()).CTFTimeAccountLimit
+		others, err := s.authorize(c.Request().Context(), logger, user, profile, limit, lang)
+		if errors.Is(err, storage.ErrUserNotPending) {
+			logger.Warn("user is no longer pending verification")
+			metrics.OAuthFailures.WithLabelValues("not_pending").Inc()
+			return s.renderPage(c, http.StatusBadRequest, i18n.PageInvalidLinkTitle, i18n.PageNotPending)
+		}
+		if err != nil {
+			logger.WithError(err).Error("failed to authorize user")
+			metrics.OAuthFailures.WithLabelValues("save").Inc()
+			return s.renderPage(c, http.StatusInternalServerError, i18n.PageErrorTitle, i18n.PageSaveFailed)
+		}
+		if len(others) > 0 {
+			logger.Warnf("CTFTime account has already verified %d Telegram accounts in the chat", len(others))
+			metrics.OAuthFailures.WithLabelValues("account_limit").Inc()
+			s.notifyAccountLimit(c.Request().Context(), chatState, user, profile, others, logger)
+			return s.renderPage(c, http.StatusForbidden, i18n.PageAccountLimitTitle, i18n.PageAccountLimit)
+		}
+
+		return s.renderPage(c, http.StatusOK, i18n.PageSuccessTitle, i18n.PageSuccess)
+	}
+}
 
-		if _, err := s.bot.Send(
+// authorize marks the user as verified and lets them into the chat.
+// If the CTFTime account has already verified as many Telegram accounts in the chat as the limit allows,
+// the user is left as is and those accounts are returned.
+func (s *Service) authorize(
+	ctx context.Context,
+	logger *logrus.Entry,
+	user *models.User,
+	profile models.CTFTimeProfile,
+	limit int,
+	lang i18n.Lang,
+) ([]*models.User, error) {
+	others, err := s.storage.OnUserAuthorizedWithinLimit(ctx, user.ID, profile, limit)
+	if err != nil {
+		return nil, fmt.Errorf("saving authorization: %w", err)
+	}
+	if len(others) > 0 {
+		return others, nil
+	}
+
+	logger.Info("successfully set oauth token")
+
+	if err := s.storage.CancelVerificationDeadline(ctx, user.ID); err != nil {
+		logger.WithError(err).Error("failed to cancel verification deadline")
+	}
+	metrics.Verifications.WithLabelValues(string(models.VerificationProviderCTFTime)).Inc()
+
+	if user.Status == models.UserStatusJoinRequested {
+		if err := s.bot.ApproveJoinRequest(
+			&telebot.Chat{ID: user.ChatID},
 			&telebot.User{ID: user.TelegramID},
-			"Successfully logged in, you can use the chat now.",
 		); err != nil {
-			logger.WithError(err).Error("failed to send success message")
+			logger.WithError(err).Error("failed to approve join request")
+		}
+	}
+
+	if user.Restricted {
+		if err := tgutil.UnrestrictMember(s.bot, user.ChatID, user.TelegramID); err != nil {
+			logger.WithError(err).Error("failed to lift restrictions")
+		} else if err := s.storage.SetUserRestricted(ctx, user.ID, false); err != nil {
+			logger.WithError(err).Error("failed to mark user as unrestricted")
 		}
+	}
 
-		return c.String(http.StatusOK, "Successfully authorized, you can close this page.")
+	if _, err := s.bot.Send(&telebot.User{ID: user.TelegramID}, lang.T(i18n.LoggedIn)); err != nil {
+		logger.WithError(err).Error("failed to send success message")
 	}
+
+	return nil, nil
 }
 
-func (s *Service) getOAuthToken(code string) (string, error) {
+func (s *Service) getOAuthToken(code, codeVerifier string) (string, error) {
 	type oauthTokenResponse struct {
 		AccessToken string `json:"access_token"`
 	}
 
+	params := map[string]string{
+		"client_id":     s.config.CTFTimeClientID,
+		"client_secret": s.config.CTFTimeClientSecret,
+		"code":          code,
+		"grant_type":    "authorization_code",
+		"redirect_uri":  s.config.CTFTimeRedirectURL,
+	}
+	if codeVerifier != "" {
+		params["code_verifier"] = codeVerifier
+	}
+
 	resp, err := s.client.R().
-		SetQueryParams(map[string]string{
-			"client_id":     s.config.CTFTimeClientID,
-			"client_secret": s.config.CTFTimeClientSecret,
-			"code":          code,
-			"grant_type":    "authorization_code",
-			"redirect_uri":  s.config.CTFTimeRedirectURL,
-		}).
+		SetQueryParams(params).
 		SetResult(&oauthTokenResponse{}).
 		Post("/token")
 	if err != nil {
@@ -122,9 +237,14 @@ func (s *Service) getOAuthToken(code string) (string, error) {
 	return resp.Result().(*oauthTokenResponse).AccessToken, nil
 }
 
-func (s *Service) getUser(token string) (int64, error) {
+// getUser fetches the CTFTime profile, the team is returned either as a single team or as a list.
+func (s *Service) getUser(token string) (models.CTFTimeProfile, error) {
 	type oauthUserResponse struct {
-		ID int64 `json:"id"`
+		ID      int64                `json:"id"`
+		Name    string               `json:"name"`
+		Country string               `json:"country"`
+		Team    *models.CTFTimeTeam  `json:"team"`
+		Teams   []models.CTFTimeTeam `json:"teams"`
 	}
 
 	resp, err := s.client.R().
@@ -132,12 +252,25 @@ func (s *Service) getUser(token string) (int64, error) {
 		SetResult(&oauthUserResponse{}).
 		Get("/user")
 	if err != nil {
-		return 0, fmt.Errorf("sending request: %w", err)
+		return models.CTFTimeProfile{}, fmt.Errorf("sending request: %w", err)
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return 0, fmt.Errorf("unexpected status code: %d %s", resp.StatusCode(), string(resp.Body()))
+		return models.CTFTimeProfile{}, fmt.Errorf("unexpected status code: %d %s", resp.StatusCode(), string(resp.Body()))
+	}
+
+	user := resp.Result().(*oauthUserResponse)
+	profile := models.CTFTimeProfile{
+		UserID:  user.ID,
+		Name:    user.Name,
+		Country: user.Country,
+		Teams:   user.Teams,
+	}
+	if user.Team != nil && !slices.ContainsFunc(profile.Teams, func(t models.CTFTimeTeam) bool {
+		return t.ID == user.Team.ID
+	}) {
+		profile.Teams = append([]models.CTFTimeTeam{*user.Team}, profile.Teams...)
 	}
 
-	return resp.Result().(*oauthUserResponse).ID, nil
+	return profile, nil
 }
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/api"
+	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/health"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/telebot.v4"
+)
+
+const apiListen = ":8080"
+
+// SetupAPIConfig sets the defaults used only by the API.
+func SetupAPIConfig() {
+	viper.MustBindEnv("ctftime_client_secret")
+}
+
+// NewAPIBot creates a bot which is only used to send messages.
+func NewAPIBot(ctx context.Context, cfg *config.Config) (telebot.API, error) {
+	bot, err := telebot.NewBot(telebot.Settings{
+		Token: cfg.TelegramToken,
+		Poller: &telebot.LongPoller{
+			Timeout: 10 * time.Second,
+		},
+		Client: metrics.TelegramClient(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating bot: %w", err)
+	}
+	return NewOutbound(ctx, cfg, bot), nil
+}
+
+type API struct {
+	echo *echo.Echo
+}
+
+func NewAPI(cfg *config.Config, store storage.Storage, bot telebot.API) *API {
+	service := api.NewService(cfg, store, bot)
+
+	e := echo.New()
+	e.HideBanner = true
+	e.GET("/oauth_callback", service.HandleOAuthCallback())
+
+	// The API doesn't process updates, so the update age isn't checked.
+	checker := health.NewChecker(store, bot, 0)
+	e.GET("/healthz", echo.WrapHandler(checker.LiveHandler()))
+	e.GET("/readyz", echo.WrapHandler(checker.ReadyHandler()))
+
+	return &API{echo: e}
+}
+
+// Run serves the API until the context is cancelled.
+func (a *API) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if err := a.echo.Start(apiListen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- fmt.Errorf("starting server: %w", err)
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	logrus.Info("shutting down server")
+	if err := a.echo.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Package app wires the services together, so they can be run
+// either as separate binaries or in a single process.
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// ConnectStorage connects to the database without touching the schema.
+func ConnectStorage(cfg *config.Config) (*storage.Postgres, error) {
+	db, err := gorm.Open(postgres.Open(cfg.PostgresDSN), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	if err := metrics.InstrumentDB(db); err != nil {
+		return nil, fmt.Errorf("instrumenting database: %w", err)
+	}
+
+	return storage.NewPostgres(db), nil
+}
+
+// OpenStorage connects to the database and applies pending migrations.
+// The in-memory storage is used in the dev mode, everything is lost on restart.
+func OpenStorage(ctx context.Context, cfg *config.Config) (storage.Storage, error) {
+	switch cfg.StorageDriver {
+	case "memory":
+		logrus.Warn("using in-memory storage, all data will be lost on restart")
+		return storage.NewMemory(), nil
+	case "postgres":
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+
+	store, err := ConnectStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrateCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err := store.Migrate(migrateCtx); err != nil {
+		return nil, fmt.Errorf("migrating database: %w", err)
+	}
+
+	return store, nil
+}
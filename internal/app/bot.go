@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/monitor"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgutil"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/telebot.v4"
+)
+
+// SetupBotConfig sets the defaults used only by the bot.
+func SetupBotConfig() {
+	viper.SetDefault("bot_handle_timeout", "10s")
+	viper.SetDefault("join_login_timeout", "10m")
+	viper.SetDefault("join_requests_enabled", true)
+	viper.SetDefault("greeting_template", "")
+	viper.SetDefault("timeout_action", "kick")
+	viper.SetDefault("show_admin_buttons", true)
+	viper.SetDefault("verification_provider", "ctftime")
+	viper.SetDefault("trust_verifications", false)
+
+	viper.SetDefault("warn_mute_threshold", 3)
+	viper.SetDefault("warn_ban_threshold", 5)
+	viper.SetDefault("warn_expiry", "720h")
+	viper.SetDefault("warn_mute_duration", "24h")
+
+	viper.SetDefault("raid_join_threshold", 10)
+	viper.SetDefault("raid_join_window", "30s")
+	viper.SetDefault("raid_quiet_period", "5m")
+	viper.SetDefault("raid_revoke_invite_link", false)
+
+	viper.SetDefault("webhook_enabled", false)
+	viper.SetDefault("webhook_listen", ":8081")
+	viper.SetDefault("webhook_url", "")
+	viper.SetDefault("webhook_secret_token", "")
+	viper.SetDefault("webhook_cert_file", "")
+	viper.SetDefault("webhook_key_file", "")
+	viper.SetDefault("webhook_upload_cert", false)
+	viper.SetDefault("webhook_delete_on_stop", true)
+
+	viper.SetDefault("cleaner_interval", "15s")
+	viper.SetDefault("chat_syncer_interval", "1m")
+}
+
+// Bot runs the monitor together with the cleaner and the admin syncer.
+type Bot struct {
+	cfg      *config.Config
+	bot      *telebot.Bot
+	outbound *tgutil.Outbound
+	webhook  *tgutil.WebhookPoller
+	monitor  *monitor.Monitor
+}
+
+func NewBot(ctx context.Context, cfg *config.Config, store storage.Storage) (*Bot, error) {
+	globalState, err := store.GetOrCreateGlobalState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting global state: %w", err)
+	}
+
+	allowedUpdates := []string{
+		"message",
+		"chat_member",
+		"my_chat_member",
+		"callback_query",
+		"chat_join_request",
+	}
+
+	var (
+		poller  telebot.Poller
+		webhook *tgutil.WebhookPoller
+	)
+	if cfg.WebhookEnabled {
+		if cfg.WebhookURL == "" || cfg.WebhookSecretToken == "" {
+			return nil, fmt.Errorf("webhook_url and webhook_secret_token are required in webhook mode")
+		}
+		webhook = &tgutil.WebhookPoller{
+			Listen:         cfg.WebhookListen,
+			PublicURL:      cfg.WebhookURL,
+			SecretToken:    cfg.WebhookSecretToken,
+			CertFile:       cfg.WebhookCertFile,
+			KeyFile:        cfg.WebhookKeyFile,
+			UploadCert:     cfg.WebhookUploadCert,
+			AllowedUpdates: allowedUpdates,
+		}
+		poller = webhook
+	} else {
+		poller = &telebot.LongPoller{
+			Timeout:        10 * time.Second,
+			LastUpdateID:   globalState.LastUpdateID,
+			AllowedUpdates: allowedUpdates,
+		}
+	}
+
+	bot, err := telebot.NewBot(telebot.Settings{
+		Token:  cfg.TelegramToken,
+		Poller: poller,
+		Client: metrics.TelegramClient(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating bot: %w", err)
+	}
+
+	if webhook != nil {
+		if err := webhook.Register(bot); err != nil {
+			return nil, fmt.Errorf("registering webhook: %w", err)
+		}
+	} else if err := bot.RemoveWebhook(); err != nil {
+		// getUpdates doesn't work while a webhook is set.
+		return nil, fmt.Errorf("removing webhook: %w", err)
+	}
+
+	outbound := NewOutbound(ctx, cfg, bot)
+	mon := monitor.New(cfg, store, outbound)
+
+	for _, updateType := range []string{
+		telebot.OnText,
+		telebot.OnForward,
+		telebot.OnMedia,
+		telebot.OnUserJoined,
+		telebot.OnUserLeft,
+		telebot.OnChatMember,
+		telebot.OnMyChatMember,
+		telebot.OnCallback,
+		telebot.OnChatJoinRequest,
+	} {
+		bot.Handle(updateType, mon.HandleAnyUpdate)
+	}
+
+	return &Bot{
+		cfg:      cfg,
+		bot:      bot,
+		outbound: outbound,
+		webhook:  webhook,
+		monitor:  mon,
+	}, nil
+}
+
+// NewOutbound wraps the bot with the configured limits and retries, waits are cancelled with ctx.
+func NewOutbound(ctx context.Context, cfg *config.Config, bot *telebot.Bot) *tgutil.Outbound {
+	return tgutil.NewOutbound(ctx, bot, tgutil.OutboundOptions{
+		GlobalRate:   cfg.TelegramGlobalRate,
+		ChatRate:     cfg.TelegramChatRate,
+		ChatBurst:    cfg.TelegramChatBurst,
+		MaxRetries:   cfg.TelegramMaxRetries,
+		RetryBackoff: cfg.TelegramRetryBackoff,
+		MaxRetryWait: cfg.TelegramMaxRetryWait,
+		MaxWait:      cfg.BotHandleTimeout,
+	})
+}
+
+// Telegram returns the bot API, so other services can send messages with it within the same limits.
+func (b *Bot) Telegram() telebot.API {
+	return b.outbound
+}
+
+// Run processes updates until the context is cancelled.
+func (b *Bot) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.bot.Start()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.monitor.RunCleaner(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.monitor.RunUpdateChatAdmins(ctx)
+	}()
+
+	<-ctx.Done()
+
+	b.bot.Stop()
+
+	if b.webhook != nil && b.cfg.WebhookDeleteOnStop {
+		if err := b.webhook.Unregister(b.bot); err != nil {
+			logrus.Errorf("failed to unregister webhook: %v", err)
+		}
+	}
+
+	logrus.Info("waiting for services to finish")
+	wg.Wait()
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/health"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// OpsServer is a private listener for metrics and probes, kept off the public API port.
+type OpsServer struct {
+	server *http.Server
+}
+
+func NewOpsServer(listen string, checker *health.Checker) *OpsServer {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /healthz", checker.LiveHandler())
+	mux.Handle("GET /readyz", checker.ReadyHandler())
+
+	return &OpsServer{
+		server: &http.Server{
+			Addr:              listen,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Run serves until the context is cancelled.
+func (s *OpsServer) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		logrus.Infof("serving ops endpoints on %s", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- fmt.Errorf("starting ops server: %w", err)
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down ops server: %w", err)
+	}
+	return nil
+}
@@ -1,25 +1,36 @@
 package authutil
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/google/uuid"
 )
 
-func GetCTFTimeOAuthURL(userID string, chatID int64, config *config.Config) (string, error) {
-	oauthURL := url.URL{
-		Scheme: "https",
-		Host:   config.CTFTimeOAuthHost,
-		Path:   "/authorize",
+var (
+	ErrStateMalformed        = errors.New("malformed state")
+	ErrStateInvalidSignature = errors.New("invalid state signature")
+	ErrStateExpired          = errors.New("state expired")
+)
+
+// GetCTFTimeOAuthURL builds the authorization URL.
+// If codeVerifier is not empty, the PKCE S256 challenge is added.
+func GetCTFTimeOAuthURL(state *State, codeVerifier string, config *config.Config) (string, error) {
+	oauthURL, err := url.Parse(config.CTFTimeOAuthBaseURL() + "/authorize")
+	if err != nil {
+		return "", fmt.Errorf("parsing oauth url: %w", err)
 	}
 
-	state, err := (&State{
-		UserID: userID,
-		ChatID: chatID,
-	}).Serialize()
+	serialized, err := state.Serialize(config.OAuthStateSecret)
 	if err != nil {
 		return "", fmt.Errorf("marshalling state: %w", err)
 	}
@@ -29,43 +40,117 @@ func GetCTFTimeOAuthURL(userID string, chatID int64, config *config.Config) (str
 	query.Set("redirect_uri", config.CTFTimeRedirectURL)
 	query.Set("scope", "profile:read")
 	query.Set("response_type", "code")
-	query.Set("state", state)
+	query.Set("state", serialized)
+	if codeVerifier != "" {
+		query.Set("code_challenge", CodeChallenge(codeVerifier))
+		query.Set("code_challenge_method", "S256")
+	}
 
 	oauthURL.RawQuery = query.Encode()
 
 	return oauthURL.String(), nil
 }
 
+// NewCodeVerifier generates a PKCE code verifier (RFC 7636).
+func NewCodeVerifier() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CodeChallenge returns the S256 challenge for the verifier.
+func CodeChallenge(codeVerifier string) string {
+	digest := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
 type State struct {
-	UserID string `json:"user_id"`
-	ChatID int64  `json:"chat_id"`
+	UserID   string `json:"user_id"`
+	ChatID   int64  `json:"chat_id"`
+	Nonce    string `json:"nonce"`
+	IssuedAt int64  `json:"issued_at"`
+	Lang     string `json:"lang,omitempty"`
+}
+
+// NewState creates a state with a fresh nonce, which must be
+// stored server-side before the state is handed out to the user.
+func NewState(userID string, chatID int64) *State {
+	return &State{
+		UserID:   userID,
+		ChatID:   chatID,
+		Nonce:    uuid.New().String(),
+		IssuedAt: time.Now().Unix(),
+	}
 }
 
 func (s *State) String() string {
-	return fmt.Sprintf("State(user=%s, chat=%d)", s.UserID, s.ChatID)
+	return fmt.Sprintf("State(user=%s, chat=%d, nonce=%s)", s.UserID, s.ChatID, s.Nonce)
 }
 
 // Serialize exists because Go calls MarshalText for structs if it's defined.
-func (s *State) Serialize() (string, error) {
+// The result is base64(json) and base64(hmac(json)) joined by a dot.
+func (s *State) Serialize(secret string) (string, error) {
+	if secret == "" {
+		return "", errors.New("state secret is not configured")
+	}
+
 	raw, err := json.Marshal(s)
 	if err != nil {
 		return "", fmt.Errorf("marshalling json: %w", err)
 	}
-	buf := make([]byte, base64.URLEncoding.EncodedLen(len(raw)))
-	base64.URLEncoding.Encode(buf, raw)
-	return string(buf), nil
+
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	signature := base64.RawURLEncoding.EncodeToString(sign(payload, secret))
+
+	return payload + "." + signature, nil
 }
 
-func StateFromString(s string) (*State, error) {
-	decoded, err := base64.URLEncoding.DecodeString(s)
+// StateFromString verifies the signature and the age of the state.
+// Replays are detected by consuming the nonce in storage.
+func StateFromString(s string, config *config.Config) (*State, error) {
+	if config.OAuthStateSecret == "" {
+		return nil, errors.New("state secret is not configured")
+	}
+
+	payload, signatureRaw, ok := strings.Cut(s, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: no signature", ErrStateMalformed)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(signatureRaw)
 	if err != nil {
-		return nil, fmt.Errorf("decoding base64: %w", err)
+		return nil, fmt.Errorf("%w: decoding signature: %w", ErrStateMalformed, err)
+	}
+
+	if !hmac.Equal(signature, sign(payload, config.OAuthStateSecret)) {
+		return nil, ErrStateInvalidSignature
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding base64: %w", ErrStateMalformed, err)
 	}
 
 	var state State
 	if err := json.Unmarshal(decoded, &state); err != nil {
-		return nil, fmt.Errorf("unmarshalling json: %w", err)
+		return nil, fmt.Errorf("%w: unmarshalling json: %w", ErrStateMalformed, err)
+	}
+
+	if state.Nonce == "" || state.UserID == "" {
+		return nil, fmt.Errorf("%w: missing fields", ErrStateMalformed)
+	}
+
+	if time.Since(time.Unix(state.IssuedAt, 0)) > config.OAuthStateTTL {
+		return nil, ErrStateExpired
 	}
 
 	return &state, nil
 }
+
+func sign(payload, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
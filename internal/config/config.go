@@ -1,8 +1,10 @@
 package config
 
 import (
+	"strings"
 	"time"
 
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -10,18 +12,103 @@ import (
 type Config struct {
 	TelegramToken string `mapstructure:"telegram_token"`
 
+	// Limits of outbound Telegram requests: global per second and messages per chat per minute.
+	TelegramGlobalRate   float64       `mapstructure:"telegram_global_rate"`
+	TelegramChatRate     float64       `mapstructure:"telegram_chat_rate"`
+	TelegramChatBurst    int           `mapstructure:"telegram_chat_burst"`
+	TelegramMaxRetries   int           `mapstructure:"telegram_max_retries"`
+	TelegramRetryBackoff time.Duration `mapstructure:"telegram_retry_backoff"`
+	TelegramMaxRetryWait time.Duration `mapstructure:"telegram_max_retry_wait"`
+
 	BotHandleTimeout time.Duration `mapstructure:"bot_handle_timeout"`
 	JoinLoginTimeout time.Duration `mapstructure:"join_login_timeout"`
 
+	// Defaults for the per-chat settings.
+	JoinRequestsEnabled  bool   `mapstructure:"join_requests_enabled"`
+	GreetingTemplate     string `mapstructure:"greeting_template"`
+	TimeoutAction        string `mapstructure:"timeout_action"`
+	ShowAdminButtons     bool   `mapstructure:"show_admin_buttons"`
+	VerificationProvider string `mapstructure:"verification_provider"`
+	Language             string `mapstructure:"language"`
+	// TrustVerifications accepts users verified with CTFTime in other chats of the bot without a new login.
+	TrustVerifications bool `mapstructure:"trust_verifications"`
+	// CTFTimeAccountLimit is the number of Telegram accounts one CTFTime account can verify in a chat, zero is unlimited.
+	CTFTimeAccountLimit int `mapstructure:"ctftime_account_limit"`
+
+	// Warnings escalate to a mute for WarnMuteDuration and to a ban at the thresholds (per-chat defaults).
+	// Zero thresholds disable the escalation, zero expiry keeps warnings forever.
+	WarnMuteThreshold int           `mapstructure:"warn_mute_threshold"`
+	WarnBanThreshold  int           `mapstructure:"warn_ban_threshold"`
+	WarnExpiry        time.Duration `mapstructure:"warn_expiry"`
+	WarnMuteDuration  time.Duration `mapstructure:"warn_mute_duration"`
+
+	// Raid mode is turned on when RaidJoinThreshold members join within RaidJoinWindow,
+	// and off after RaidQuietPeriod without joins. Zero threshold disables the detection.
+	RaidJoinThreshold    int           `mapstructure:"raid_join_threshold"`
+	RaidJoinWindow       time.Duration `mapstructure:"raid_join_window"`
+	RaidQuietPeriod      time.Duration `mapstructure:"raid_quiet_period"`
+	RaidRevokeInviteLink bool          `mapstructure:"raid_revoke_invite_link"`
+
+	// Webhook mode, long polling is used if disabled.
+	WebhookEnabled      bool   `mapstructure:"webhook_enabled"`
+	WebhookListen       string `mapstructure:"webhook_listen"`
+	WebhookURL          string `mapstructure:"webhook_url"`
+	WebhookSecretToken  string `mapstructure:"webhook_secret_token"`
+	WebhookCertFile     string `mapstructure:"webhook_cert_file"`
+	WebhookKeyFile      string `mapstructure:"webhook_key_file"`
+	WebhookUploadCert   bool   `mapstructure:"webhook_upload_cert"`
+	WebhookDeleteOnStop bool   `mapstructure:"webhook_delete_on_stop"`
+
+	// OpsListen is the private address serving metrics and probes, the public API only serves probes.
+	OpsListen string `mapstructure:"ops_listen"`
+	// HealthMaxUpdateAge fails the bot's readiness probe if no update was processed for longer,
+	// zero disables the check. Quiet chats may produce no updates for hours, so it's off by default.
+	HealthMaxUpdateAge time.Duration `mapstructure:"health_max_update_age"`
+
 	CleanerInterval    time.Duration `mapstructure:"cleaner_interval"`
 	ChatSyncerInterval time.Duration `mapstructure:"chat_syncer_interval"`
 
 	CTFTimeClientID     string `mapstructure:"ctftime_client_id"`
 	CTFTimeClientSecret string `mapstructure:"ctftime_client_secret"`
 	CTFTimeOAuthHost    string `mapstructure:"ctftime_oauth_host"`
-	CTFTimeRedirectURL  string `mapstructure:"ctftime_redirect_url"`
+	// CTFTimeOAuthURL overrides CTFTimeOAuthHost with a full base url, e.g. of the mock provider.
+	CTFTimeOAuthURL    string `mapstructure:"ctftime_oauth_url"`
+	CTFTimeRedirectURL string `mapstructure:"ctftime_redirect_url"`
+	CTFTimePKCE        bool   `mapstructure:"ctftime_pkce"`
+
+	OAuthStateSecret string        `mapstructure:"oauth_state_secret"`
+	OAuthStateTTL    time.Duration `mapstructure:"oauth_state_ttl"`
 
-	PostgresDSN string `mapstructure:"postgres_dsn"`
+	// StorageDriver is either postgres or memory, the latter is for the dev mode only.
+	StorageDriver string `mapstructure:"storage_driver"`
+	PostgresDSN   string `mapstructure:"postgres_dsn"`
+}
+
+// CTFTimeOAuthBaseURL is the full base URL of the OAuth provider, like http://localhost:8090 for a mock.
+// Only the host can be set for backward compatibility, https is used then.
+func (c *Config) CTFTimeOAuthBaseURL() string {
+	if c.CTFTimeOAuthURL != "" {
+		return strings.TrimSuffix(c.CTFTimeOAuthURL, "/")
+	}
+	return "https://" + c.CTFTimeOAuthHost
+}
+
+// ChatDefaults are the settings of chats without overrides.
+func (c *Config) ChatDefaults() models.EffectiveSettings {
+	return models.EffectiveSettings{
+		JoinLoginTimeout:     c.JoinLoginTimeout,
+		GreetingTemplate:     c.GreetingTemplate,
+		TimeoutAction:        models.TimeoutAction(c.TimeoutAction),
+		ShowAdminButtons:     c.ShowAdminButtons,
+		VerificationProvider: models.VerificationProvider(c.VerificationProvider),
+		JoinRequestsEnabled:  c.JoinRequestsEnabled,
+		Language:             c.Language,
+		WarnMuteThreshold:    c.WarnMuteThreshold,
+		WarnBanThreshold:     c.WarnBanThreshold,
+		WarnExpiry:           c.WarnExpiry,
+		TrustVerifications:   c.TrustVerifications,
+		CTFTimeAccountLimit:  c.CTFTimeAccountLimit,
+	}
 }
 
 func New() *Config {
@@ -34,11 +121,26 @@ func New() *Config {
 
 func SetupCommon() {
 	viper.SetDefault("ctftime_oauth_host", "oauth.ctftime.org")
+	viper.SetDefault("ctftime_oauth_url", "")
 	viper.SetDefault("ctftime_redirect_url", "http://localhost:8080/oauth_callback")
+	viper.SetDefault("ctftime_pkce", false)
+	viper.SetDefault("ctftime_account_limit", 0)
+	viper.SetDefault("oauth_state_ttl", "15m")
+	viper.SetDefault("language", "en")
+	viper.SetDefault("health_max_update_age", 0)
+	viper.SetDefault("ops_listen", ":9090")
+	viper.SetDefault("storage_driver", "postgres")
+	viper.SetDefault("telegram_global_rate", 25)
+	viper.SetDefault("telegram_chat_rate", 20)
+	viper.SetDefault("telegram_chat_burst", 3)
+	viper.SetDefault("telegram_max_retries", 3)
+	viper.SetDefault("telegram_retry_backoff", "500ms")
+	viper.SetDefault("telegram_max_retry_wait", "30s")
 	viper.SetEnvPrefix("SHPAGA")
 
 	viper.MustBindEnv("telegram_token")
 	viper.MustBindEnv("ctftime_client_id")
 	viper.MustBindEnv("postgres_dsn")
+	viper.MustBindEnv("oauth_state_secret")
 	viper.AutomaticEnv()
 }
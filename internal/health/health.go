@@ -0,0 +1,112 @@
+// Package health implements the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"gopkg.in/telebot.v4"
+)
+
+const checkTimeout = 5 * time.Second
+
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Checker reports the state of the service dependencies.
+// Liveness only checks that the process serves requests, so a working process is never restarted,
+// while readiness checks Postgres, Telegram and, if enabled, the age of the last processed update.
+type Checker struct {
+	storage storage.Storage
+	bot     telebot.API
+
+	// maxUpdateAge disables the update age check when zero,
+	// as quiet chats may legitimately produce no updates for a long time.
+	// Only the bot processes updates, the API passes zero.
+	maxUpdateAge time.Duration
+}
+
+func NewChecker(storage storage.Storage, bot telebot.API, maxUpdateAge time.Duration) *Checker {
+	return &Checker{
+		storage:      storage,
+		bot:          bot,
+		maxUpdateAge: maxUpdateAge,
+	}
+}
+
+// LiveHandler serves /healthz.
+func (c *Checker) LiveHandler() http.Handler {
+	return handler(nil)
+}
+
+// ReadyHandler serves /readyz.
+func (c *Checker) ReadyHandler() http.Handler {
+	checks := []check{
+		{"postgres", c.checkPostgres},
+		{"telegram", c.checkTelegram},
+	}
+	if c.maxUpdateAge > 0 {
+		checks = append(checks, check{"last_update", c.checkLastUpdate})
+	}
+	return handler(checks)
+}
+
+func (c *Checker) checkPostgres(ctx context.Context) error {
+	return c.storage.Ping(ctx)
+}
+
+func (c *Checker) checkTelegram(context.Context) error {
+	if _, err := c.bot.Raw("getMe", nil); err != nil {
+		return fmt.Errorf("calling getMe: %w", err)
+	}
+	return nil
+}
+
+func (c *Checker) checkLastUpdate(ctx context.Context) error {
+	state, err := c.storage.GetGlobalState(ctx)
+	if err != nil {
+		return err
+	}
+	if state.LastUpdateAt == nil {
+		// Nothing was processed since the update age tracking was added.
+		return nil
+	}
+	if age := time.Since(*state.LastUpdateAt); age > c.maxUpdateAge {
+		return fmt.Errorf("last update %d was processed %v ago", state.LastUpdateID, age.Round(time.Second))
+	}
+	return nil
+}
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func handler(checks []check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		resp := response{Status: "ok", Checks: make(map[string]string, len(checks))}
+		status := http.StatusOK
+		for _, ch := range checks {
+			if err := ch.run(ctx); err != nil {
+				resp.Checks[ch.name] = err.Error()
+				resp.Status = "fail"
+				status = http.StatusServiceUnavailable
+			} else {
+				resp.Checks[ch.name] = "ok"
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,61 @@
+package health_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/health"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgtest"
+)
+
+func newChecker(t *testing.T, maxUpdateAge time.Duration) *health.Checker {
+	t.Helper()
+
+	tg := tgtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	bot, err := tg.NewBot()
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+
+	store := storage.NewMemory()
+	if _, err := store.GetOrCreateGlobalState(context.Background()); err != nil {
+		t.Fatalf("creating global state: %v", err)
+	}
+	if err := store.UpdateLastUpdate(context.Background(), 1); err != nil {
+		t.Fatalf("updating last update: %v", err)
+	}
+	return health.NewChecker(store, bot, maxUpdateAge)
+}
+
+func probe(handler http.Handler) int {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code
+}
+
+func TestStaleUpdateFailsOnlyReadiness(t *testing.T) {
+	checker := newChecker(t, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if code := probe(checker.LiveHandler()); code != http.StatusOK {
+		t.Fatalf("liveness returned %d, want 200", code)
+	}
+	if code := probe(checker.ReadyHandler()); code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness returned %d, want 503", code)
+	}
+}
+
+func TestUpdateAgeCheckDisabled(t *testing.T) {
+	checker := newChecker(t, 0)
+	time.Sleep(time.Millisecond)
+
+	if code := probe(checker.ReadyHandler()); code != http.StatusOK {
+		t.Fatalf("readiness returned %d, want 200", code)
+	}
+}
@@ -0,0 +1,150 @@
+package i18n
+
+var english = map[Key]string{
+	MinutesOne:  "%d minute",
+	MinutesFew:  "%d minutes",
+	MinutesMany: "%d minutes",
+	HoursOne:    "%d hour",
+	HoursFew:    "%d hours",
+	HoursMany:   "%d hours",
+	DaysOne:     "%d day",
+	DaysFew:     "%d days",
+	DaysMany:    "%d days",
+
+	GreetingTemplate: `Welcome to the chat, {mention}\! ` +
+		`Please, press the button below, start the bot and follow the instructions ` +
+		`to log in with [CTFTime](https://ctftime.org)\. ` +
+		`You won't be able to send messages until you do so\. ` +
+		`The bot will kick you in {timeout} if you don't login\.`,
+	AdminGreetingTemplate: `Welcome to the chat, {mention}\! ` +
+		`An admin has to accept you before you can send messages\. ` +
+		`The bot will kick you in {timeout} if nobody does\.`,
+
+	LoginButton:  "Log in with CTFTime",
+	AcceptButton: "✅ Accept (admin only)",
+	KickButton:   "❌ Kick (admin only)",
+
+	JoinRequestLogin: "To join %s, log in with CTFTime using the button below. " +
+		"The request will be declined in %s if you don't login.",
+	InvalidChatID:         "Invalid chat id",
+	UnexpectedStatus:      "You have an unexpected status %q",
+	AdminVerificationOnly: "This chat requires an admin to accept new members, please wait.",
+	FollowLoginLink:       "Follow the link below to log in with CTFTime",
+
+	NotAdmin:          "you are not an admin: %v",
+	BadCallbackData:   "bad callback data",
+	BadUserID:         "bad user id",
+	UserNotJustJoined: "user status is not just joined",
+	Saved:             "Saved",
+
+	SettingsTitle:         "Chat settings (admin only):",
+	SettingsVerification:  "Verification: %s",
+	SettingsTimeout:       "Login timeout: %s",
+	SettingsTimeoutAction: "On timeout: %s",
+	SettingsAdminButtons:  "Admin buttons: %s",
+	SettingsJoinRequests:  "Join requests: %s",
+	SettingsGreeting:      "Greeting: %s",
+	SettingsTrust:         "Trust verifications in other chats: %s",
+	SettingsAccountLimit:  "Telegram accounts per CTFTime account: %s",
+	SettingsWarnMute:      "Mute after warnings: %s",
+	SettingsWarnBan:       "Ban after warnings: %s",
+	SettingsWarnExpiry:    "Warnings expire in: %s",
+	SettingsLanguage:      "Language: %s",
+	SettingsHint:          "Use /setgreeting <template> to change the greeting and /resetgreeting to restore the default one.",
+	SettingsReset:         "Reset to defaults",
+	SettingsClose:         "Close",
+
+	On:                   "on",
+	Off:                  "off",
+	Never:                "never",
+	GreetingDefault:      "default",
+	GreetingCustom:       "custom",
+	ProviderCTFTime:      "CTFTime",
+	ProviderAdmin:        "admin",
+	TimeoutActionKick:    "kick",
+	TimeoutActionBan:     "ban",
+	LanguageName:         "English",
+	GreetingRejected:     "Greeting template rejected: %v\n\nUsage: /setgreeting <template>, placeholders: %s",
+	GreetingRejectedByTG: "Greeting template rejected by Telegram: %v",
+	GreetingSaved:        "Greeting saved, the preview is above.",
+	GreetingReset:        "Greeting reset to the default one.",
+
+	RaidSummary: "🚨 Mass join detected, %d accounts joined so far. Greetings are paused and new members can't send messages. " +
+		"New members: press the button below to log in with CTFTime, otherwise you will be removed in %s.",
+	RaidSummaryAdmin: "🚨 Mass join detected, %d accounts joined so far. Greetings are paused, " +
+		"new members can't send messages and will be removed in %s. Admins can accept them with /accept <@username or id>.",
+	RaidStarted:     "🚨 Mass join detected in %s, raid mode is on: greetings are paused and new members are restricted. It will be turned off after %s without joins.",
+	RaidLinkRevoked: "The invite link was revoked, a new one will be sent after the raid.",
+	RaidEnded:       "✅ Raid mode is off in %s, %d accounts joined during the raid.",
+	RaidNewLink:     "New invite link: %s",
+
+	ModerationNoTarget:    "Reply to a message of the user or pass their @username or id: /%s <user>",
+	ModerationUnknownUser: "User %s hasn't been seen in this chat, pass their id instead.",
+	ModerationTargetAdmin: "Admins can't be moderated.",
+	ModerationBadDuration: "Pass the mute duration of at least a minute, e.g. /mute 30m or /mute @user 7d.",
+	ModerationFailed:      "Telegram rejected the action: %v",
+	ModerationBanned:      "🔨 %s was banned by %s.",
+	ModerationKicked:      "👢 %s was kicked by %s.",
+	ModerationMuted:       "🔇 %s was muted for %s by %s.",
+	ModerationUnbanned:    "✅ %s was unbanned by %s.",
+	ModerationAccepted:    "✅ %s was accepted by %s.",
+	ModerationNotPending:  "%s is not waiting for verification.",
+	ModerationMutePending: "%s hasn't passed the verification yet and can't write until then, not muting.",
+
+	WarnIssued:        "⚠️ %s was warned by %s, active warnings: %d. Reason: %s",
+	WarnNoReason:      "not specified",
+	WarnEscalatedMute: "🔇 Muted for %s after %d warnings.",
+	WarnEscalatedBan:  "🔨 Banned after %d warnings.",
+	WarnsTitle:        "Active warnings of %s: %d",
+	WarnsItem:         "%d. %s by %s: %s",
+	WarnsNone:         "%s has no active warnings.",
+	WarnRevoked:       "↩️ The last warning of %s was revoked by %s, active warnings: %d.",
+
+	WhoisUnknown:     "%s hasn't been seen in this chat.",
+	WhoisTelegram:    "Telegram: %s",
+	WhoisStatus:      "Status: %s",
+	WhoisNotVerified: "Not verified with CTFTime",
+	WhoisVerified:    "Verified with CTFTime: %s",
+	WhoisUnknownTime: "time unknown",
+	WhoisCTFTime:     "CTFTime: %s",
+	WhoisCountry:     "Country: %s",
+	WhoisTeams:       "Teams: %s",
+
+	FedCreateUsage:   "Usage: /fedcreate <name>",
+	FedCreated:       "Federation %q created, bans in this chat are now shared with its chats. To add another chat, send /fedjoin %s there, only you can do it.",
+	FedAlreadyJoined: "This chat is already in a federation, send /fedleave first.",
+	FedNotFound:      "Federation not found, usage: /fedjoin <federation id>",
+	FedNotOwner:      "Only the owner of the federation can add chats to it.",
+	FedJoined:        "This chat joined federation %q, bans are now shared with its chats.",
+	FedNotJoined:     "This chat is not in a federation.",
+	FedLeft:          "This chat left the federation, bans are no longer shared.",
+	FedBanKept:       "The user is still banned in the other chats of the federation, only the chat that banned them or the federation owner can lift the federation ban.",
+
+	TrustedVerified: "✅ %s is verified via CTFTime as %s",
+
+	AccountLimitExceeded: "⚠️ In %s, CTFTime account %s was used to verify Telegram account %s, but it has already verified %s (limit %d). " +
+		"The login was rejected, accept the user in the chat or remove them.",
+
+	LoggedIn: "Successfully logged in, you can use the chat now.",
+
+	PageInvalidLinkTitle:  "Invalid link",
+	PageCodeMissing:       "Login code is missing.",
+	PageStateMissing:      "Login state is missing.",
+	PageLinkInvalid:       "This login link is not valid.",
+	PageLinkMalformed:     "This login link is malformed.",
+	PageLinkExpiredTitle:  "Link expired",
+	PageLinkExpired:       "This login link has expired. Send /start to the bot again to get a new one.",
+	PageLinkUsedTitle:     "Link already used",
+	PageLinkUsed:          "This login link has already been used. Send /start to the bot again to get a new one.",
+	PageErrorTitle:        "Error",
+	PageVerifyFailed:      "Failed to verify the login link.",
+	PageUserFailed:        "Failed to get user.",
+	PageTokenFailed:       "Failed to get CTFTime token.",
+	PageCTFTimeUserFailed: "Failed to get CTFTime user.",
+	PageSaveFailed:        "Failed to save authorization.",
+	PageAccountLimitTitle: "Account already used",
+	PageAccountLimit:      "This CTFTime account has already verified too many Telegram accounts in this chat. The chat admins were notified and can let you in.",
+	PageNotPending:        "You are no longer waiting for verification in this chat, this login link can't be used.",
+	PageSuccessTitle:      "Success",
+	PageSuccess:           "Successfully authorized, you can close this page.",
+}
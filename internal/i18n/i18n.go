@@ -0,0 +1,115 @@
+package i18n
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Lang string
+
+const (
+	English Lang = "en"
+	Russian Lang = "ru"
+
+	Default = English
+)
+
+var catalogs = map[Lang]map[Key]string{
+	English: english,
+	Russian: russian,
+}
+
+// Supported returns the languages with a catalog, in a stable order.
+func Supported() []Lang {
+	return []Lang{English, Russian}
+}
+
+// Parse maps a language code like "ru" or "en-US" to a supported language.
+// ok is false if the language is not supported.
+func Parse(code string) (Lang, bool) {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(code)), "-")
+	lang := Lang(base)
+	if _, ok := catalogs[lang]; !ok {
+		return "", false
+	}
+	return lang, true
+}
+
+// ParseOr is Parse with a fallback language.
+func ParseOr(code string, fallback Lang) Lang {
+	if lang, ok := Parse(code); ok {
+		return lang
+	}
+	return fallback
+}
+
+// FromAcceptLanguage picks the most preferred supported language from the Accept-Language header.
+func FromAcceptLanguage(header string, fallback Lang) Lang {
+	best, bestQ := fallback, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang, ok := Parse(tag); ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// T returns the message in the language formatted with args,
+// falling back to English for missing translations.
+func (l Lang) T(key Key, args ...any) string {
+	msg, ok := catalogs[l][key]
+	if !ok {
+		msg, ok = english[key]
+	}
+	if !ok {
+		return string(key)
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Duration formats whole hours and minutes with words, other durations as is.
+func (l Lang) Duration(d time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case d >= day && d%day == 0:
+		return l.plural(int(d/day), DaysOne, DaysFew, DaysMany)
+	case d >= time.Hour && d%time.Hour == 0:
+		return l.plural(int(d/time.Hour), HoursOne, HoursFew, HoursMany)
+	case d >= time.Minute && d%time.Minute == 0:
+		return l.plural(int(d/time.Minute), MinutesOne, MinutesFew, MinutesMany)
+	default:
+		return d.String()
+	}
+}
+
+func (l Lang) plural(n int, one, few, many Key) string {
+	key := many
+	switch l {
+	case Russian:
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			key = one
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			key = few
+		}
+	default:
+		if n == 1 {
+			key = one
+		}
+	}
+	return l.T(key, n)
+}
@@ -0,0 +1,144 @@
+package i18n
+
+// Key identifies a message in the catalogs.
+type Key string
+
+const (
+	MinutesOne  Key = "minutes_one"
+	MinutesFew  Key = "minutes_few"
+	MinutesMany Key = "minutes_many"
+	HoursOne    Key = "hours_one"
+	HoursFew    Key = "hours_few"
+	HoursMany   Key = "hours_many"
+	DaysOne     Key = "days_one"
+	DaysFew     Key = "days_few"
+	DaysMany    Key = "days_many"
+
+	// GreetingTemplate and AdminGreetingTemplate are MarkdownV2 greeting templates.
+	GreetingTemplate      Key = "greeting_template"
+	AdminGreetingTemplate Key = "admin_greeting_template"
+
+	LoginButton  Key = "login_button"
+	AcceptButton Key = "accept_button"
+	KickButton   Key = "kick_button"
+
+	JoinRequestLogin      Key = "join_request_login"
+	InvalidChatID         Key = "invalid_chat_id"
+	UnexpectedStatus      Key = "unexpected_status"
+	AdminVerificationOnly Key = "admin_verification_only"
+	FollowLoginLink       Key = "follow_login_link"
+
+	NotAdmin          Key = "not_admin"
+	BadCallbackData   Key = "bad_callback_data"
+	BadUserID         Key = "bad_user_id"
+	UserNotJustJoined Key = "user_not_just_joined"
+	Saved             Key = "saved"
+
+	SettingsTitle         Key = "settings_title"
+	SettingsVerification  Key = "settings_verification"
+	SettingsTimeout       Key = "settings_timeout"
+	SettingsTimeoutAction Key = "settings_timeout_action"
+	SettingsAdminButtons  Key = "settings_admin_buttons"
+	SettingsJoinRequests  Key = "settings_join_requests"
+	SettingsGreeting      Key = "settings_greeting"
+	SettingsTrust         Key = "settings_trust"
+	SettingsAccountLimit  Key = "settings_account_limit"
+	SettingsWarnMute      Key = "settings_warn_mute"
+	SettingsWarnBan       Key = "settings_warn_ban"
+	SettingsWarnExpiry    Key = "settings_warn_expiry"
+	SettingsLanguage      Key = "settings_language"
+	SettingsHint          Key = "settings_hint"
+	SettingsReset         Key = "settings_reset"
+	SettingsClose         Key = "settings_close"
+
+	On                   Key = "on"
+	Off                  Key = "off"
+	Never                Key = "never"
+	GreetingDefault      Key = "greeting_default"
+	GreetingCustom       Key = "greeting_custom"
+	ProviderCTFTime      Key = "provider_ctftime"
+	ProviderAdmin        Key = "provider_admin"
+	TimeoutActionKick    Key = "timeout_action_kick"
+	TimeoutActionBan     Key = "timeout_action_ban"
+	LanguageName         Key = "language_name"
+	GreetingRejected     Key = "greeting_rejected"
+	GreetingRejectedByTG Key = "greeting_rejected_by_tg"
+	GreetingSaved        Key = "greeting_saved"
+	GreetingReset        Key = "greeting_reset"
+
+	RaidSummary      Key = "raid_summary"
+	RaidSummaryAdmin Key = "raid_summary_admin"
+	RaidStarted      Key = "raid_started"
+	RaidLinkRevoked  Key = "raid_link_revoked"
+	RaidEnded        Key = "raid_ended"
+	RaidNewLink      Key = "raid_new_link"
+
+	ModerationNoTarget    Key = "moderation_no_target"
+	ModerationUnknownUser Key = "moderation_unknown_user"
+	ModerationTargetAdmin Key = "moderation_target_admin"
+	ModerationBadDuration Key = "moderation_bad_duration"
+	ModerationFailed      Key = "moderation_failed"
+	ModerationBanned      Key = "moderation_banned"
+	ModerationKicked      Key = "moderation_kicked"
+	ModerationMuted       Key = "moderation_muted"
+	ModerationUnbanned    Key = "moderation_unbanned"
+	ModerationAccepted    Key = "moderation_accepted"
+	ModerationNotPending  Key = "moderation_not_pending"
+	ModerationMutePending Key = "moderation_mute_pending"
+
+	WarnIssued        Key = "warn_issued"
+	WarnNoReason      Key = "warn_no_reason"
+	WarnEscalatedMute Key = "warn_escalated_mute"
+	WarnEscalatedBan  Key = "warn_escalated_ban"
+	WarnsTitle        Key = "warns_title"
+	WarnsItem         Key = "warns_item"
+	WarnsNone         Key = "warns_none"
+	WarnRevoked       Key = "warn_revoked"
+
+	WhoisUnknown     Key = "whois_unknown"
+	WhoisTelegram    Key = "whois_telegram"
+	WhoisStatus      Key = "whois_status"
+	WhoisNotVerified Key = "whois_not_verified"
+	WhoisVerified    Key = "whois_verified"
+	WhoisUnknownTime Key = "whois_unknown_time"
+	WhoisCTFTime     Key = "whois_ctftime"
+	WhoisCountry     Key = "whois_country"
+	WhoisTeams       Key = "whois_teams"
+
+	FedCreateUsage   Key = "fed_create_usage"
+	FedCreated       Key = "fed_created"
+	FedAlreadyJoined Key = "fed_already_joined"
+	FedNotFound      Key = "fed_not_found"
+	FedNotOwner      Key = "fed_not_owner"
+	FedJoined        Key = "fed_joined"
+	FedNotJoined     Key = "fed_not_joined"
+	FedLeft          Key = "fed_left"
+	FedBanKept       Key = "fed_ban_kept"
+
+	TrustedVerified Key = "trusted_verified"
+
+	AccountLimitExceeded Key = "account_limit_exceeded"
+
+	LoggedIn Key = "logged_in"
+
+	PageInvalidLinkTitle  Key = "page_invalid_link_title"
+	PageCodeMissing       Key = "page_code_missing"
+	PageStateMissing      Key = "page_state_missing"
+	PageLinkInvalid       Key = "page_link_invalid"
+	PageLinkMalformed     Key = "page_link_malformed"
+	PageLinkExpiredTitle  Key = "page_link_expired_title"
+	PageLinkExpired       Key = "page_link_expired"
+	PageLinkUsedTitle     Key = "page_link_used_title"
+	PageLinkUsed          Key = "page_link_used"
+	PageErrorTitle        Key = "page_error_title"
+	PageVerifyFailed      Key = "page_verify_failed"
+	PageUserFailed        Key = "page_user_failed"
+	PageTokenFailed       Key = "page_token_failed"
+	PageCTFTimeUserFailed Key = "page_ctftime_user_failed"
+	PageSaveFailed        Key = "page_save_failed"
+	PageAccountLimitTitle Key = "page_account_limit_title"
+	PageAccountLimit      Key = "page_account_limit"
+	PageNotPending        Key = "page_not_pending"
+	PageSuccessTitle      Key = "page_success_title"
+	PageSuccess           Key = "page_success"
+)
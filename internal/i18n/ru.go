@@ -0,0 +1,150 @@
+package i18n
+
+var russian = map[Key]string{
+	MinutesOne:  "%d минуту",
+	MinutesFew:  "%d минуты",
+	MinutesMany: "%d минут",
+	HoursOne:    "%d час",
+	HoursFew:    "%d часа",
+	HoursMany:   "%d часов",
+	DaysOne:     "%d день",
+	DaysFew:     "%d дня",
+	DaysMany:    "%d дней",
+
+	GreetingTemplate: `Добро пожаловать в чат, {mention}\! ` +
+		`Пожалуйста, нажмите на кнопку ниже, запустите бота и следуйте инструкциям, ` +
+		`чтобы войти через [CTFTime](https://ctftime.org)\. ` +
+		`Вы не сможете отправлять сообщения, пока не сделаете это\. ` +
+		`Бот исключит вас через {timeout}, если вы не войдёте\.`,
+	AdminGreetingTemplate: `Добро пожаловать в чат, {mention}\! ` +
+		`Администратор должен принять вас, прежде чем вы сможете отправлять сообщения\. ` +
+		`Бот исключит вас через {timeout}, если этого не произойдёт\.`,
+
+	LoginButton:  "Войти через CTFTime",
+	AcceptButton: "✅ Принять (только админы)",
+	KickButton:   "❌ Исключить (только админы)",
+
+	JoinRequestLogin: "Чтобы вступить в %s, войдите через CTFTime с помощью кнопки ниже. " +
+		"Заявка будет отклонена через %s, если вы не войдёте.",
+	InvalidChatID:         "Неверный идентификатор чата",
+	UnexpectedStatus:      "У вас неожиданный статус %q",
+	AdminVerificationOnly: "В этом чате новых участников принимает администратор, пожалуйста, подождите.",
+	FollowLoginLink:       "Перейдите по ссылке ниже, чтобы войти через CTFTime",
+
+	NotAdmin:          "вы не администратор: %v",
+	BadCallbackData:   "некорректные данные",
+	BadUserID:         "некорректный id пользователя",
+	UserNotJustJoined: "пользователь не ожидает проверки",
+	Saved:             "Сохранено",
+
+	SettingsTitle:         "Настройки чата (только для админов):",
+	SettingsVerification:  "Проверка: %s",
+	SettingsTimeout:       "Время на вход: %s",
+	SettingsTimeoutAction: "По истечении: %s",
+	SettingsAdminButtons:  "Кнопки админов: %s",
+	SettingsJoinRequests:  "Заявки на вступление: %s",
+	SettingsGreeting:      "Приветствие: %s",
+	SettingsTrust:         "Доверять входам в других чатах: %s",
+	SettingsAccountLimit:  "Аккаунтов Telegram на аккаунт CTFTime: %s",
+	SettingsWarnMute:      "Мьют после предупреждений: %s",
+	SettingsWarnBan:       "Бан после предупреждений: %s",
+	SettingsWarnExpiry:    "Предупреждения истекают через: %s",
+	SettingsLanguage:      "Язык: %s",
+	SettingsHint:          "Используйте /setgreeting <шаблон>, чтобы изменить приветствие, и /resetgreeting, чтобы вернуть стандартное.",
+	SettingsReset:         "Сбросить",
+	SettingsClose:         "Закрыть",
+
+	On:                   "вкл",
+	Off:                  "выкл",
+	Never:                "никогда",
+	GreetingDefault:      "стандартное",
+	GreetingCustom:       "своё",
+	ProviderCTFTime:      "CTFTime",
+	ProviderAdmin:        "администратор",
+	TimeoutActionKick:    "исключить",
+	TimeoutActionBan:     "забанить",
+	LanguageName:         "Русский",
+	GreetingRejected:     "Шаблон приветствия отклонён: %v\n\nИспользование: /setgreeting <шаблон>, подстановки: %s",
+	GreetingRejectedByTG: "Telegram отклонил шаблон приветствия: %v",
+	GreetingSaved:        "Приветствие сохранено, пример выше.",
+	GreetingReset:        "Приветствие сброшено на стандартное.",
+
+	RaidSummary: "🚨 Обнаружен массовый вход, уже вступило %d аккаунтов. Приветствия приостановлены, новые участники не могут писать сообщения. " +
+		"Новые участники: нажмите на кнопку ниже, чтобы войти через CTFTime, иначе вас исключат через %s.",
+	RaidSummaryAdmin: "🚨 Обнаружен массовый вход, уже вступило %d аккаунтов. Приветствия приостановлены, " +
+		"новые участники не могут писать сообщения и будут исключены через %s. Администраторы могут принять их командой /accept <@username или id>.",
+	RaidStarted:     "🚨 Обнаружен массовый вход в %s, включён режим рейда: приветствия приостановлены, новые участники ограничены. Режим выключится через %s без новых вступлений.",
+	RaidLinkRevoked: "Ссылка-приглашение отозвана, новая будет отправлена после рейда.",
+	RaidEnded:       "✅ Режим рейда в %s выключен, за время рейда вступило %d аккаунтов.",
+	RaidNewLink:     "Новая ссылка-приглашение: %s",
+
+	ModerationNoTarget:    "Ответьте на сообщение пользователя или укажите его @username или id: /%s <пользователь>",
+	ModerationUnknownUser: "Пользователь %s не встречался в этом чате, укажите его id.",
+	ModerationTargetAdmin: "Администраторов нельзя модерировать.",
+	ModerationBadDuration: "Укажите длительность мьюта не меньше минуты, например /mute 30m или /mute @user 7d.",
+	ModerationFailed:      "Telegram отклонил действие: %v",
+	ModerationBanned:      "🔨 %s заблокирован администратором %s.",
+	ModerationKicked:      "👢 %s исключён администратором %s.",
+	ModerationMuted:       "🔇 %s лишён права писать на %s администратором %s.",
+	ModerationUnbanned:    "✅ %s разблокирован администратором %s.",
+	ModerationAccepted:    "✅ %s принят администратором %s.",
+	ModerationNotPending:  "%s не ожидает проверки.",
+	ModerationMutePending: "%s ещё не прошёл проверку и до этого не может писать, ограничение не применено.",
+
+	WarnIssued:        "⚠️ %s получил предупреждение от %s, активных предупреждений: %d. Причина: %s",
+	WarnNoReason:      "не указана",
+	WarnEscalatedMute: "🔇 Лишён права писать на %s после %d предупреждений.",
+	WarnEscalatedBan:  "🔨 Заблокирован после %d предупреждений.",
+	WarnsTitle:        "Активные предупреждения %s: %d",
+	WarnsItem:         "%d. %s от %s: %s",
+	WarnsNone:         "У %s нет активных предупреждений.",
+	WarnRevoked:       "↩️ Последнее предупреждение %s отозвано администратором %s, активных предупреждений: %d.",
+
+	WhoisUnknown:     "%s не встречался в этом чате.",
+	WhoisTelegram:    "Telegram: %s",
+	WhoisStatus:      "Статус: %s",
+	WhoisNotVerified: "Не подтверждён через CTFTime",
+	WhoisVerified:    "Подтверждён через CTFTime: %s",
+	WhoisUnknownTime: "время неизвестно",
+	WhoisCTFTime:     "CTFTime: %s",
+	WhoisCountry:     "Страна: %s",
+	WhoisTeams:       "Команды: %s",
+
+	FedCreateUsage:   "Использование: /fedcreate <название>",
+	FedCreated:       "Федерация %q создана, баны в этом чате теперь общие с её чатами. Чтобы добавить другой чат, отправьте там /fedjoin %s, это можете сделать только вы.",
+	FedAlreadyJoined: "Этот чат уже состоит в федерации, сначала отправьте /fedleave.",
+	FedNotFound:      "Федерация не найдена, использование: /fedjoin <id федерации>",
+	FedNotOwner:      "Добавлять чаты в федерацию может только её владелец.",
+	FedJoined:        "Чат вступил в федерацию %q, баны теперь общие с её чатами.",
+	FedNotJoined:     "Этот чат не состоит в федерации.",
+	FedLeft:          "Чат вышел из федерации, баны больше не общие.",
+	FedBanKept:       "Пользователь остаётся забаненным в других чатах федерации, снять бан федерации может только чат, который его выдал, или владелец федерации.",
+
+	TrustedVerified: "✅ %s подтверждён через CTFTime как %s",
+
+	AccountLimitExceeded: "⚠️ В %s аккаунтом CTFTime %s пытались подтвердить аккаунт Telegram %s, но им уже подтверждены: %s (лимит %d). " +
+		"Вход отклонён, примите пользователя в чате или удалите его.",
+
+	LoggedIn: "Вход выполнен, теперь вы можете писать в чат.",
+
+	PageInvalidLinkTitle:  "Неверная ссылка",
+	PageCodeMissing:       "Отсутствует код входа.",
+	PageStateMissing:      "Отсутствует состояние входа.",
+	PageLinkInvalid:       "Эта ссылка для входа недействительна.",
+	PageLinkMalformed:     "Эта ссылка для входа повреждена.",
+	PageLinkExpiredTitle:  "Ссылка устарела",
+	PageLinkExpired:       "Срок действия ссылки истёк. Отправьте боту /start ещё раз, чтобы получить новую.",
+	PageLinkUsedTitle:     "Ссылка уже использована",
+	PageLinkUsed:          "Эта ссылка уже была использована. Отправьте боту /start ещё раз, чтобы получить новую.",
+	PageErrorTitle:        "Ошибка",
+	PageVerifyFailed:      "Не удалось проверить ссылку для входа.",
+	PageUserFailed:        "Не удалось получить пользователя.",
+	PageTokenFailed:       "Не удалось получить токен CTFTime.",
+	PageCTFTimeUserFailed: "Не удалось получить пользователя CTFTime.",
+	PageSaveFailed:        "Не удалось сохранить авторизацию.",
+	PageAccountLimitTitle: "Аккаунт уже использован",
+	PageAccountLimit:      "Этим аккаунтом CTFTime уже подтверждено слишком много аккаунтов Telegram в этом чате. Администраторы чата получили уведомление и могут впустить вас.",
+	PageNotPending:        "Вы больше не ожидаете проверки в этом чате, эту ссылку для входа нельзя использовать.",
+	PageSuccessTitle:      "Готово",
+	PageSuccess:           "Вход выполнен, эту страницу можно закрыть.",
+}
@@ -0,0 +1,99 @@
+// Package metrics defines the Prometheus metrics shared by the bot and the API.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shpaga"
+
+var (
+	Joins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "joins_total",
+		Help:      "Users joining chats or requesting to join, by kind.",
+	}, []string{"kind"})
+
+	Verifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "verifications_total",
+		Help:      "Successfully verified users, by provider.",
+	}, []string{"provider"})
+
+	AdminActions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admin_actions_total",
+		Help:      "Moderation actions of chat admins, by action.",
+	}, []string{"action"})
+
+	TimeoutRemovals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "timeout_removals_total",
+		Help:      "Users removed by the cleaner after the login timeout, by action.",
+	}, []string{"action"})
+
+	DeletedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deleted_messages_total",
+		Help:      "Messages deleted by the bot, by reason.",
+	}, []string{"reason"})
+
+	Raids = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "raids_total",
+		Help:      "Join bursts which switched a chat into raid mode.",
+	})
+
+	FederationBans = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "federation_bans_total",
+		Help:      "Bans applied to other chats of a federation and federation-banned joiners removed, by action.",
+	}, []string{"action"})
+
+	TelegramErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_api_errors_total",
+		Help:      "Failed Telegram Bot API requests, by method.",
+	}, []string{"method"})
+
+	TelegramRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_retries_total",
+		Help:      "Retried Telegram Bot API operations, by method.",
+	}, []string{"method"})
+
+	TelegramFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_failed_operations_total",
+		Help:      "Telegram Bot API operations failed after all retries, by method.",
+	}, []string{"method"})
+
+	OAuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "oauth_failures_total",
+		Help:      "Failed OAuth callbacks, by stage.",
+	}, []string{"stage"})
+
+	UpdateDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "update_handle_duration_seconds",
+		Help:      "Time spent handling a Telegram update.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	StorageQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_query_duration_seconds",
+		Help:      "Time spent in database queries, by operation.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+)
+
+// Handler serves the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"net/http"
+	"path"
+	"time"
+)
+
+// TelegramClient returns an HTTP client for telebot counting failed requests by method.
+func TelegramClient() *http.Client {
+	return &http.Client{
+		// Same as the telebot default.
+		Timeout:   time.Minute,
+		Transport: &telegramTransport{base: http.DefaultTransport},
+	}
+}
+
+type telegramTransport struct {
+	base http.RoundTripper
+}
+
+func (t *telegramTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The path is /bot<token>/<method>, only the method is safe to expose.
+	method := path.Base(req.URL.Path)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		TelegramErrors.WithLabelValues(method).Inc()
+	}
+	return resp, err
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// AccountLimitNotice records that the admins of the chat were told about the Telegram account
+// rejected by the CTFTime account limit, so repeated logins don't notify them again.
+type AccountLimitNotice struct {
+	ChatID        int64 `gorm:"primaryKey"`
+	CTFTimeUserID int64 `gorm:"column:ctftime_user_id;primaryKey"`
+	TelegramID    int64 `gorm:"primaryKey"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (n *AccountLimitNotice) String() string {
+	return fmt.Sprintf("AccountLimitNotice(%d, %d, %d)", n.ChatID, n.CTFTimeUserID, n.TelegramID)
+}
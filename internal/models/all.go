@@ -1,8 +0,0 @@
-package models
-
-var All = []any{
-	&User{},
-	ChatState{},
-	&GlobalState{},
-	&Message{},
-}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+type TimeoutAction string
+
+const (
+	TimeoutActionKick TimeoutAction = "kick"
+	TimeoutActionBan  TimeoutAction = "ban"
+)
+
+type VerificationProvider string
+
+const (
+	// VerificationProviderCTFTime requires users to log in with CTFTime.
+	VerificationProviderCTFTime VerificationProvider = "ctftime"
+	// VerificationProviderAdmin requires an admin to accept each new user.
+	VerificationProviderAdmin VerificationProvider = "admin"
+)
+
+// ChatSettings are per-chat overrides, nil fields fall back to the global config.
+type ChatSettings struct {
+	JoinLoginTimeout     *time.Duration        `json:"join_login_timeout,omitempty"`
+	GreetingTemplate     *string               `json:"greeting_template,omitempty"`
+	TimeoutAction        *TimeoutAction        `json:"timeout_action,omitempty"`
+	ShowAdminButtons     *bool                 `json:"show_admin_buttons,omitempty"`
+	VerificationProvider *VerificationProvider `json:"verification_provider,omitempty"`
+	JoinRequestsEnabled  *bool                 `json:"join_requests_enabled,omitempty"`
+	Language             *string               `json:"language,omitempty"`
+	WarnMuteThreshold    *int                  `json:"warn_mute_threshold,omitempty"`
+	WarnBanThreshold     *int                  `json:"warn_ban_threshold,omitempty"`
+	WarnExpiry           *time.Duration        `json:"warn_expiry,omitempty"`
+	TrustVerifications   *bool                 `json:"trust_verifications,omitempty"`
+	CTFTimeAccountLimit  *int                  `json:"ctftime_account_limit,omitempty"`
+}
+
+// EffectiveSettings are ChatSettings with the defaults applied.
+type EffectiveSettings struct {
+	JoinLoginTimeout     time.Duration
+	GreetingTemplate     string
+	TimeoutAction        TimeoutAction
+	ShowAdminButtons     bool
+	VerificationProvider VerificationProvider
+	JoinRequestsEnabled  bool
+	Language             string
+	WarnMuteThreshold    int
+	WarnBanThreshold     int
+	WarnExpiry           time.Duration
+	TrustVerifications   bool
+	CTFTimeAccountLimit  int
+}
+
+// Effective applies the overrides to the defaults, usually the ones of the global config.
+func (s *ChatSettings) Effective(defaults EffectiveSettings) EffectiveSettings {
+	return EffectiveSettings{
+		JoinLoginTimeout:     valueOr(s.JoinLoginTimeout, defaults.JoinLoginTimeout),
+		GreetingTemplate:     valueOr(s.GreetingTemplate, defaults.GreetingTemplate),
+		TimeoutAction:        valueOr(s.TimeoutAction, defaults.TimeoutAction),
+		ShowAdminButtons:     valueOr(s.ShowAdminButtons, defaults.ShowAdminButtons),
+		VerificationProvider: valueOr(s.VerificationProvider, defaults.VerificationProvider),
+		JoinRequestsEnabled:  valueOr(s.JoinRequestsEnabled, defaults.JoinRequestsEnabled),
+		Language:             valueOr(s.Language, defaults.Language),
+		WarnMuteThreshold:    valueOr(s.WarnMuteThreshold, defaults.WarnMuteThreshold),
+		WarnBanThreshold:     valueOr(s.WarnBanThreshold, defaults.WarnBanThreshold),
+		WarnExpiry:           valueOr(s.WarnExpiry, defaults.WarnExpiry),
+		TrustVerifications:   valueOr(s.TrustVerifications, defaults.TrustVerifications),
+		CTFTimeAccountLimit:  valueOr(s.CTFTimeAccountLimit, defaults.CTFTimeAccountLimit),
+	}
+}
+
+func valueOr[T any](v *T, def T) T {
+	if v == nil {
+		return def
+	}
+	return *v
+}
@@ -13,8 +13,17 @@ type ChatState struct {
 
 	Member *telebot.ChatMember  `gorm:"type:jsonb;serializer:json"`
 	Admins []telebot.ChatMember `gorm:"type:jsonb;serializer:json"`
+
+	Settings ChatSettings `gorm:"type:jsonb;serializer:json"`
+
+	// FederationID is the federation the chat shares bans with, nil if none.
+	FederationID *string `gorm:"type:uuid;index"`
 }
 
 func (s *ChatState) IsGroup() bool {
 	return s.ChatType == telebot.ChatGroup || s.ChatType == telebot.ChatSuperGroup
 }
+
+func (s *ChatState) EffectiveSettings(defaults EffectiveSettings) EffectiveSettings {
+	return s.Settings.Effective(defaults)
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Federation is a group of chats sharing a ban list, chats are added by the owner.
+type Federation struct {
+	ID      string `gorm:"type:uuid;primaryKey"`
+	Name    string
+	OwnerID int64
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (f *Federation) String() string {
+	return fmt.Sprintf("Federation(%s, %q)", f.ID, f.Name)
+}
+
+// FederationBan bans the Telegram user in all chats of the federation.
+type FederationBan struct {
+	FederationID string `gorm:"type:uuid;primaryKey"`
+	TelegramID   int64  `gorm:"primaryKey"`
+
+	// ChatID is the chat the user was banned in, BannedBy is the admin who banned them.
+	ChatID   int64
+	BannedBy int64
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (b *FederationBan) String() string {
+	return fmt.Sprintf("FederationBan(%s, %d)", b.FederationID, b.TelegramID)
+}
+
+// FederationAction is a federation ban or unban waiting to be applied in a chat of the federation.
+// Actions are applied by the cleaner and retried until they succeed or run out of attempts,
+// a newer action for the same user and chat replaces the pending one.
+type FederationAction struct {
+	ChatID     int64 `gorm:"primaryKey"`
+	TelegramID int64 `gorm:"primaryKey"`
+	Ban        bool
+
+	// Attempts counts the failed attempts, NextAttemptAt also leases the action while a cleaner applies it.
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+
+	CreatedAt time.Time
+}
+
+func (a *FederationAction) String() string {
+	return fmt.Sprintf("FederationAction(%d, %d, ban=%t)", a.ChatID, a.TelegramID, a.Ban)
+}
@@ -1,6 +1,9 @@
 package models
 
+import "time"
+
 type GlobalState struct {
 	ID           int `gorm:"primaryKey"`
 	LastUpdateID int
+	LastUpdateAt *time.Time
 }
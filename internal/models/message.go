@@ -8,7 +8,9 @@ import (
 type MessageType string
 
 const (
-	MessageTypeGreeting MessageType = "greeting"
+	MessageTypeGreeting    MessageType = "greeting"
+	MessageTypeJoinRequest MessageType = "join_request"
+	MessageTypeRaidSummary MessageType = "raid_summary"
 )
 
 type Message struct {
@@ -19,7 +21,8 @@ type Message struct {
 
 	AssociatedUserID string `gorm:"index"`
 
-	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+	CreatedAt time.Time  `gorm:"autoCreateTime;index"`
+	ExpiresAt *time.Time `gorm:"index"`
 }
 
 func (m *Message) MessageSig() (string, int64) {
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+type OAuthState struct {
+	Nonce  string `gorm:"primaryKey"`
+	UserID string `gorm:"type:uuid;index"`
+
+	// CodeVerifier is the PKCE verifier, empty if PKCE is disabled.
+	CodeVerifier string
+
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+	UsedAt    *time.Time
+}
+
+func (s *OAuthState) String() string {
+	return fmt.Sprintf("OAuthState(%s, %s)", s.Nonce, s.UserID)
+}
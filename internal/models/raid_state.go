@@ -0,0 +1,31 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// RaidState tracks the recent joins of a chat and the raid in progress.
+// It's shared by the bot replicas, so joins seen by any of them are counted together.
+type RaidState struct {
+	ChatID int64 `gorm:"primaryKey"`
+	// Joins are the join times within the window while the chat is not in raid mode.
+	Joins      []time.Time `gorm:"type:jsonb;serializer:json"`
+	LastJoinAt time.Time
+
+	Active   bool
+	Joined   int
+	Language string
+	Title    string
+	// LoginTimeout is the time raid joiners have to log in, the summary is kept for it after the last join.
+	LoginTimeout time.Duration
+
+	// SummaryMessageID is the message with the login button of the raid joiners, zero until it's sent.
+	SummaryMessageID int
+	SummaryUpdatedAt time.Time
+	LinkRevoked      bool
+}
+
+func (s *RaidState) String() string {
+	return fmt.Sprintf("RaidState(%d, active=%t, joined=%d)", s.ChatID, s.Active, s.Joined)
+}
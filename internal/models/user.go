@@ -1,24 +1,91 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
 
 type UserStatus string
 
 const (
-	UserStatusJustJoined UserStatus = "just_joined"
-	UserStatusBanned     UserStatus = "banned"
-	UserStatusActive     UserStatus = "active"
-	UserStatusKicked     UserStatus = "kicked"
+	UserStatusJustJoined    UserStatus = "just_joined"
+	UserStatusJoinRequested UserStatus = "join_requested"
+	UserStatusBanned        UserStatus = "banned"
+	UserStatusActive        UserStatus = "active"
+	UserStatusKicked        UserStatus = "kicked"
 )
 
 type User struct {
 	ID         string `gorm:"type:uuid;primaryKey"`
-	ChatID     int64  `gorm:"uniqueIndex:idx_chat_telegram"`
-	TelegramID int64  `gorm:"uniqueIndex:idx_chat_telegram"`
+	ChatID     int64  `gorm:"uniqueIndex:idx_chat_telegram;index:idx_users_chat_ctftime"`
+	TelegramID int64  `gorm:"uniqueIndex:idx_chat_telegram;index"`
+
+	CTFTimeUserID  int64         `gorm:"column:ctftime_user_id;index:idx_users_chat_ctftime"`
+	CTFTimeName    string        `gorm:"column:ctftime_name"`
+	CTFTimeCountry string        `gorm:"column:ctftime_country"`
+	CTFTimeTeams   []CTFTimeTeam `gorm:"column:ctftime_teams;type:jsonb;serializer:json"`
+	// VerifiedAt is the time of the last CTFTime login.
+	VerifiedAt *time.Time
+
+	// Username is the last seen Telegram username, used to resolve @mentions in commands.
+	Username string
 
-	CTFTimeUserID int64 `gorm:"column:ctftime_user_id"`
+	// Restricted is set when the bot has revoked the user's permission to send messages.
+	Restricted bool
 
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	Status    UserStatus
 }
+
+// CTFTimeProfileURL is the public CTFTime profile of the user, empty if not verified.
+func (u *User) CTFTimeProfileURL() string {
+	return u.CTFTimeProfile().URL()
+}
+
+// TelegramIdentity names the Telegram account by the last seen username and id.
+func (u *User) TelegramIdentity() string {
+	if u.Username == "" {
+		return strconv.FormatInt(u.TelegramID, 10)
+	}
+	return fmt.Sprintf("@%s (%d)", u.Username, u.TelegramID)
+}
+
+// CTFTimeProfile is the CTFTime account the user has logged in with.
+type CTFTimeProfile struct {
+	UserID  int64
+	Name    string
+	Country string
+	Teams   []CTFTimeTeam
+}
+
+// URL is the public profile, empty if there is no account.
+func (p CTFTimeProfile) URL() string {
+	if p.UserID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("https://ctftime.org/user/%d", p.UserID)
+}
+
+// Identity names the account with a link to the profile.
+func (p CTFTimeProfile) Identity() string {
+	if p.Name == "" {
+		return p.URL()
+	}
+	return fmt.Sprintf("%s (%s)", p.Name, p.URL())
+}
+
+type CTFTimeTeam struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func (u *User) CTFTimeProfile() CTFTimeProfile {
+	return CTFTimeProfile{
+		UserID:  u.CTFTimeUserID,
+		Name:    u.CTFTimeName,
+		Country: u.CTFTimeCountry,
+		Teams:   u.CTFTimeTeams,
+	}
+}
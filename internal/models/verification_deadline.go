@@ -0,0 +1,22 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// VerificationDeadline is the time by which the user must pass verification,
+// the user is removed from the chat by the cleaner after it.
+type VerificationDeadline struct {
+	UserID string    `gorm:"type:uuid;primaryKey"`
+	DueAt  time.Time `gorm:"index"`
+	// ClaimedUntil is set while a cleaner processes the deadline,
+	// the deadline is claimed again after it if the cleaner fails or dies.
+	ClaimedUntil *time.Time
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (d *VerificationDeadline) String() string {
+	return fmt.Sprintf("VerificationDeadline(%s, %s)", d.UserID, d.DueAt)
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Warning is issued to a user by a chat admin, only unexpired warnings count towards the escalation.
+type Warning struct {
+	ID     string `gorm:"type:uuid;primaryKey"`
+	UserID string `gorm:"type:uuid;index"`
+
+	IssuerID   int64
+	IssuerName string
+	Reason     string
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	// ExpiresAt is nil for warnings which never expire.
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("Warning(%s, %s)", w.ID, w.UserID)
+}
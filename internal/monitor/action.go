@@ -9,6 +9,7 @@ type CallbackAction string
 const (
 	CallbackActionNewMemberAccept CallbackAction = "new_member_accept"
 	CallbackActionNewMemberKick   CallbackAction = "new_member_kick"
+	CallbackActionSettings        CallbackAction = "settings"
 )
 
 func (a CallbackAction) String() string {
@@ -19,3 +20,9 @@ func (a CallbackAction) DataMatches(data string) bool {
 	cringePrefix := "\f" + a.String()
 	return data == cringePrefix || strings.HasPrefix(data, cringePrefix+"|")
 }
+
+// Payload returns the data passed after the action name.
+func (a CallbackAction) Payload(data string) string {
+	_, payload, _ := strings.Cut(data, "|")
+	return payload
+}
@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"strings"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgutil"
+)
+
+// parseCommand extracts the command and its arguments from the message text.
+// Commands addressed to other bots (/cmd@other_bot) are ignored.
+func parseCommand(text, botUsername string) (string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+
+	head, args := text, ""
+	if i := strings.IndexAny(text, " \t\n"); i >= 0 {
+		head, args = text[:i], text[i+1:]
+	}
+	head = strings.TrimPrefix(head, "/")
+
+	cmd, target, addressed := strings.Cut(head, "@")
+	if addressed && !strings.EqualFold(target, botUsername) {
+		return "", "", false
+	}
+	if cmd == "" {
+		return "", "", false
+	}
+
+	return strings.ToLower(cmd), strings.TrimSpace(args), true
+}
+
+type commandHandler func(m *Monitor, uc *UpdateContext, args string) error
+
+// adminCommands are the group commands available to chat admins only.
+var adminCommands = map[string]commandHandler{
+	"settings": func(m *Monitor, uc *UpdateContext, _ string) error {
+		return m.HandleSettingsCommand(uc)
+	},
+	"setgreeting": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleSetGreetingCommand(uc, args)
+	},
+	"resetgreeting": func(m *Monitor, uc *UpdateContext, _ string) error {
+		return m.HandleResetGreetingCommand(uc)
+	},
+	"ban": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleModerationCommand(uc, moderationBan, args)
+	},
+	"kick": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleModerationCommand(uc, moderationKick, args)
+	},
+	"mute": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleModerationCommand(uc, moderationMute, args)
+	},
+	"unban": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleModerationCommand(uc, moderationUnban, args)
+	},
+	"accept": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleAcceptCommand(uc, args)
+	},
+	"warn": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleWarnCommand(uc, args)
+	},
+	"warns": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleWarnsCommand(uc, args)
+	},
+	"unwarn": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleUnwarnCommand(uc, args)
+	},
+	"whois": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleWhoisCommand(uc, args)
+	},
+	"fedcreate": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleFedCreateCommand(uc, args)
+	},
+	"fedjoin": func(m *Monitor, uc *UpdateContext, args string) error {
+		return m.HandleFedJoinCommand(uc, args)
+	},
+	"fedleave": func(m *Monitor, uc *UpdateContext, _ string) error {
+		return m.HandleFedLeaveCommand(uc)
+	},
+}
+
+// adminCommand returns the handler for the admin command in the message, if any.
+func (m *Monitor) adminCommand(uc *UpdateContext) (commandHandler, string, bool) {
+	cmd, args, ok := parseCommand(uc.Message().Text, tgutil.Me(uc.Bot()).Username)
+	if !ok {
+		return nil, "", false
+	}
+
+	handler, ok := adminCommands[cmd]
+	if !ok {
+		return nil, "", false
+	}
+
+	if err := m.checkSenderAdmin(uc); err != nil {
+		uc.L().Infof("ignoring admin command %q from non-admin: %v", cmd, err)
+		return nil, "", false
+	}
+
+	return handler, args, true
+}
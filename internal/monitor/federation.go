@@ -0,0 +1,318 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+const (
+	// federationActionLease is how long a claimed federation action is kept from other cleaners.
+	federationActionLease = 5 * time.Minute
+	// federationActionAttempts is how many times a federation action is attempted before it's dropped.
+	federationActionAttempts = 10
+)
+
+// HandleFedCreateCommand creates a federation owned by the sender with the chat as the first member.
+func (m *Monitor) HandleFedCreateCommand(uc *UpdateContext, name string) error {
+	uc.L().Info("handling federation create command")
+
+	if name == "" {
+		m.replyCommand(uc, uc.Lang().T(i18n.FedCreateUsage))
+		return nil
+	}
+	if uc.ChatState().FederationID != nil {
+		m.replyCommand(uc, uc.Lang().T(i18n.FedAlreadyJoined))
+		return nil
+	}
+
+	federation := &models.Federation{
+		Name:    name,
+		OwnerID: uc.Sender().ID,
+	}
+	if err := m.storage.CreateFederation(uc, federation); err != nil {
+		return fmt.Errorf("creating federation: %w", err)
+	}
+
+	uc.ChatState().FederationID = &federation.ID
+	if err := m.storage.UpdateChatFederation(uc, uc.ChatState()); err != nil {
+		return fmt.Errorf("updating chat federation: %w", err)
+	}
+
+	uc.L().Infof("created %v", federation)
+
+	m.replyCommand(uc, uc.Lang().T(i18n.FedCreated, federation.Name, federation.ID))
+	return nil
+}
+
+// HandleFedJoinCommand adds the chat to the federation, only the federation owner can do it.
+func (m *Monitor) HandleFedJoinCommand(uc *UpdateContext, args string) error {
+	uc.L().Info("handling federation join command")
+
+	if uc.ChatState().FederationID != nil {
+		m.replyCommand(uc, uc.Lang().T(i18n.FedAlreadyJoined))
+		return nil
+	}
+
+	federationID := strings.TrimSpace(args)
+	if _, err := uuid.Parse(federationID); err != nil {
+		m.replyCommand(uc, uc.Lang().T(i18n.FedNotFound))
+		return nil
+	}
+
+	federation, err := m.storage.GetFederation(uc, federationID)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.replyCommand(uc, uc.Lang().T(i18n.FedNotFound))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting federation: %w", err)
+	}
+
+	if federation.OwnerID != uc.Sender().ID {
+		uc.L().Warnf("sender is not the owner of %v", federation)
+		m.replyCommand(uc, uc.Lang().T(i18n.FedNotOwner))
+		return nil
+	}
+
+	uc.ChatState().FederationID = &federation.ID
+	if err := m.storage.UpdateChatFederation(uc, uc.ChatState()); err != nil {
+		return fmt.Errorf("updating chat federation: %w", err)
+	}
+
+	uc.L().Infof("chat joined %v", federation)
+
+	m.replyCommand(uc, uc.Lang().T(i18n.FedJoined, federation.Name))
+	return nil
+}
+
+func (m *Monitor) HandleFedLeaveCommand(uc *UpdateContext) error {
+	uc.L().Info("handling federation leave command")
+
+	federationID := uc.ChatState().FederationID
+	if federationID == nil {
+		m.replyCommand(uc, uc.Lang().T(i18n.FedNotJoined))
+		return nil
+	}
+
+	uc.ChatState().FederationID = nil
+	if err := m.storage.UpdateChatFederation(uc, uc.ChatState()); err != nil {
+		return fmt.Errorf("updating chat federation: %w", err)
+	}
+
+	uc.L().Infof("chat left federation %s", *federationID)
+
+	m.replyCommand(uc, uc.Lang().T(i18n.FedLeft))
+	return nil
+}
+
+// isFederationBanned reports whether the sender is banned in the federation of the chat.
+func (m *Monitor) isFederationBanned(uc *UpdateContext) bool {
+	federationID := uc.ChatState().FederationID
+	if federationID == nil {
+		return false
+	}
+
+	ban, err := m.storage.GetFederationBan(uc, *federationID, uc.Sender().ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		uc.L().Errorf("failed to get federation ban: %v", err)
+		return false
+	}
+
+	uc.L().Infof("sender is banned in the federation: %v", ban)
+	return true
+}
+
+// propagateFederationBan records the ban in the federation of the chat and queues the ban in the other chats.
+func (m *Monitor) propagateFederationBan(uc *UpdateContext, user *models.User) {
+	federationID := uc.ChatState().FederationID
+	if federationID == nil {
+		return
+	}
+
+	if err := m.storage.AddFederationBan(uc, &models.FederationBan{
+		FederationID: *federationID,
+		TelegramID:   user.TelegramID,
+		ChatID:       user.ChatID,
+		BannedBy:     uc.Sender().ID,
+	}); err != nil {
+		uc.L().Errorf("failed to add federation ban: %v", err)
+		return
+	}
+
+	m.queueFederationActions(uc, *federationID, user.TelegramID, true)
+}
+
+// propagateFederationUnban lifts the federation ban and queues the unban in the other chats.
+// Only the chat that issued the ban or the federation owner can lift it, other chats only unban locally.
+func (m *Monitor) propagateFederationUnban(uc *UpdateContext, user *models.User) {
+	federationID := uc.ChatState().FederationID
+	if federationID == nil {
+		return
+	}
+
+	ban, err := m.storage.GetFederationBan(uc, *federationID, user.TelegramID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		uc.L().Errorf("failed to get federation ban: %v", err)
+		return
+	}
+
+	if ban.ChatID != uc.Chat().ID {
+		federation, err := m.storage.GetFederation(uc, *federationID)
+		if err != nil {
+			uc.L().Errorf("failed to get federation: %v", err)
+			return
+		}
+		if federation.OwnerID != uc.Sender().ID {
+			uc.L().Infof("keeping %v issued in chat %d", ban, ban.ChatID)
+			if err := uc.Send(uc.Lang().T(i18n.FedBanKept)); err != nil {
+				uc.L().Errorf("failed to send message: %v", err)
+			}
+			return
+		}
+	}
+
+	if err := m.storage.DeleteFederationBan(uc, *federationID, user.TelegramID); err != nil {
+		uc.L().Errorf("failed to delete federation ban: %v", err)
+		return
+	}
+
+	m.queueFederationActions(uc, *federationID, user.TelegramID, false)
+}
+
+// queueFederationActions queues the ban or unban of the user in the other chats of the federation.
+// The cleaner applies them in the background, so large federations don't hold up the update.
+func (m *Monitor) queueFederationActions(uc *UpdateContext, federationID string, telegramID int64, ban bool) {
+	chats, err := m.storage.GetFederationChats(uc, federationID)
+	if err != nil {
+		uc.L().Errorf("failed to get federation chats: %v", err)
+		return
+	}
+
+	now := time.Now()
+	actions := make([]*models.FederationAction, 0, len(chats))
+	for _, chat := range chats {
+		if chat.ChatID == uc.Chat().ID {
+			continue
+		}
+		actions = append(actions, &models.FederationAction{
+			ChatID:        chat.ChatID,
+			TelegramID:    telegramID,
+			Ban:           ban,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+
+	if err := m.storage.QueueFederationActions(uc, actions); err != nil {
+		uc.L().Errorf("failed to queue federation actions: %v", err)
+		return
+	}
+	uc.L().Infof("queued %d federation actions", len(actions))
+}
+
+// applyFederationActions applies the due federation actions in batches until none are due.
+// Failed actions are retried with a growing delay and dropped after federationActionAttempts.
+func (m *Monitor) applyFederationActions(ctx context.Context, logger *logrus.Entry) {
+	for ctx.Err() == nil {
+		actions, err := m.storage.ClaimDueFederationActions(ctx, time.Now(), federationActionLease)
+		if err != nil {
+			logger.Errorf("failed to claim federation actions: %v", err)
+			return
+		}
+		if len(actions) == 0 {
+			return
+		}
+		for _, action := range actions {
+			actionLogger := logger.WithField("federation.chat_id", action.ChatID)
+			if err := m.applyFederationAction(ctx, actionLogger, action); err != nil {
+				if action.Attempts+1 >= federationActionAttempts {
+					actionLogger.Errorf("failed to apply %v, giving up: %v", action, err)
+					if err := m.storage.CompleteFederationAction(ctx, action); err != nil {
+						actionLogger.Errorf("failed to drop %v: %v", action, err)
+					}
+					continue
+				}
+				actionLogger.Warnf("failed to apply %v, retrying later: %v", action, err)
+				retryAt := time.Now().Add(federationActionRetryDelay(action.Attempts))
+				if err := m.storage.RetryFederationAction(ctx, action, retryAt); err != nil {
+					actionLogger.Errorf("failed to retry %v: %v", action, err)
+				}
+				continue
+			}
+			if err := m.storage.CompleteFederationAction(ctx, action); err != nil {
+				actionLogger.Errorf("failed to complete %v: %v", action, err)
+			}
+		}
+		logger.Infof("processed %d federation actions", len(actions))
+	}
+}
+
+func (m *Monitor) applyFederationAction(ctx context.Context, logger *logrus.Entry, action *models.FederationAction) error {
+	chat := &telebot.Chat{ID: action.ChatID}
+	tgUser := &telebot.User{ID: action.TelegramID}
+
+	if action.Ban {
+		if err := m.bot.Ban(chat, &telebot.ChatMember{User: tgUser}); err != nil {
+			return fmt.Errorf("banning user: %w", err)
+		}
+
+		chatUser, err := m.storage.GetOrCreateUser(ctx, action.ChatID, action.TelegramID, models.UserStatusBanned)
+		if err != nil {
+			return fmt.Errorf("getting user: %w", err)
+		}
+		if err := m.storage.SetUserStatus(ctx, chatUser.ID, models.UserStatusBanned); err != nil {
+			return fmt.Errorf("setting user status: %w", err)
+		}
+		if err := m.storage.CancelVerificationDeadline(ctx, chatUser.ID); err != nil {
+			return fmt.Errorf("cancelling verification deadline: %w", err)
+		}
+		m.forgetLoginLinks(ctx, logger, chatUser)
+
+		metrics.FederationBans.WithLabelValues("ban").Inc()
+		return nil
+	}
+
+	if err := m.bot.Unban(chat, tgUser, true); err != nil {
+		return fmt.Errorf("unbanning user: %w", err)
+	}
+
+	chatUser, err := m.storage.GetChatUser(ctx, action.ChatID, action.TelegramID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+	if chatUser.Status != models.UserStatusBanned {
+		return nil
+	}
+
+	if err := m.storage.SetUserStatus(ctx, chatUser.ID, unbannedStatus(chatUser)); err != nil {
+		return fmt.Errorf("setting user status: %w", err)
+	}
+
+	metrics.FederationBans.WithLabelValues("unban").Inc()
+	return nil
+}
+
+// federationActionRetryDelay doubles the delay with each failed attempt, from a minute up to an hour.
+func federationActionRetryDelay(attempts int) time.Duration {
+	return min(time.Minute<<min(attempts, 6), time.Hour)
+}
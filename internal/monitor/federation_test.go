@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgtest"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFederationActionRetryDelay(t *testing.T) {
+	for attempts, want := range []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		8 * time.Minute,
+		16 * time.Minute,
+		32 * time.Minute,
+		time.Hour,
+		time.Hour,
+	} {
+		if got := federationActionRetryDelay(attempts); got != want {
+			t.Errorf("federationActionRetryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+
+	// The delay stays capped however many attempts failed.
+	if got := federationActionRetryDelay(federationActionAttempts * 10); got != time.Hour {
+		t.Errorf("delay after many attempts is %v, want an hour", got)
+	}
+}
+
+func TestApplyFederationActionsGivesUp(t *testing.T) {
+	tg := tgtest.NewServer()
+	defer tg.Close()
+
+	bot, err := tg.NewBot()
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+
+	ctx := context.Background()
+	store := storage.NewMemory()
+	m := New(&config.Config{}, store, bot)
+
+	now := time.Now()
+	if err := store.QueueFederationActions(ctx, []*models.FederationAction{
+		{ChatID: -1, TelegramID: 42, Ban: true, Attempts: federationActionAttempts - 1, NextAttemptAt: now, CreatedAt: now},
+		{ChatID: -2, TelegramID: 42, Ban: true, NextAttemptAt: now, CreatedAt: now.Add(time.Millisecond)},
+	}); err != nil {
+		t.Fatalf("queueing federation actions: %v", err)
+	}
+
+	// The action out of attempts is dropped, the other one is retried.
+	tg.Fail("kickChatMember", http.StatusInternalServerError, 0)
+	tg.Fail("kickChatMember", http.StatusInternalServerError, 0)
+	m.applyFederationActions(ctx, logrus.NewEntry(logrus.StandardLogger()))
+
+	actions, err := store.ClaimDueFederationActions(ctx, now.Add(24*time.Hour), time.Minute)
+	if err != nil {
+		t.Fatalf("claiming federation actions: %v", err)
+	}
+	if len(actions) != 1 || actions[0].ChatID != -2 || actions[0].Attempts != 1 {
+		t.Fatalf("remaining actions %v, want the retried one", actions)
+	}
+}
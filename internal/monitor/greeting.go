@@ -0,0 +1,186 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgutil"
+	"gopkg.in/telebot.v4"
+)
+
+const maxGreetingLength = 4096
+
+var (
+	greetingPlaceholders = []string{
+		"{mention}",
+		"{chat_title}",
+		"{timeout}",
+		"{login_button}",
+	}
+
+	placeholderRe = regexp.MustCompile(`\{[a-z_]*\}`)
+)
+
+// greetingValues are the placeholder values, already formatted as MarkdownV2.
+type greetingValues struct {
+	Mention     string
+	ChatTitle   string
+	Timeout     string
+	LoginButton string
+}
+
+func newGreetingValues(
+	lang i18n.Lang,
+	name string,
+	userID int64,
+	chatTitle string,
+	timeout time.Duration,
+	loginURL string,
+) greetingValues {
+	return greetingValues{
+		Mention:     fmt.Sprintf("[%s](tg://user?id=%d)", escapeMarkdownV2(name), userID),
+		ChatTitle:   escapeMarkdownV2(chatTitle),
+		Timeout:     escapeMarkdownV2(lang.Duration(timeout)),
+		LoginButton: fmt.Sprintf("[%s](%s)", escapeMarkdownV2(lang.T(i18n.LoginButton)), loginURL),
+	}
+}
+
+// greetingTemplate returns the template for the chat, falling back to the default one for the language.
+func greetingTemplate(settings models.EffectiveSettings, lang i18n.Lang) string {
+	switch {
+	case settings.GreetingTemplate != "":
+		return settings.GreetingTemplate
+	case settings.VerificationProvider == models.VerificationProviderAdmin:
+		return lang.T(i18n.AdminGreetingTemplate)
+	default:
+		return lang.T(i18n.GreetingTemplate)
+	}
+}
+
+func renderGreeting(template string, values greetingValues) string {
+	return strings.NewReplacer(
+		"{mention}", values.Mention,
+		"{chat_title}", values.ChatTitle,
+		"{timeout}", values.Timeout,
+		"{login_button}", values.LoginButton,
+	).Replace(template)
+}
+
+// validateGreetingTemplate checks the placeholders and renders
+// the template with sample values to validate the MarkdownV2 markup.
+func validateGreetingTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("template is empty")
+	}
+
+	for _, placeholder := range placeholderRe.FindAllString(template, -1) {
+		if !slices.Contains(greetingPlaceholders, placeholder) {
+			return fmt.Errorf(
+				"unknown placeholder %s, available: %s",
+				placeholder,
+				strings.Join(greetingPlaceholders, ", "),
+			)
+		}
+	}
+
+	rendered := renderGreeting(template, newGreetingValues(
+		i18n.Default,
+		"Sample User",
+		1,
+		"Sample Chat",
+		10*time.Minute,
+		"https://t.me/sample_bot?start=1",
+	))
+
+	if utf8.RuneCountInString(rendered) > maxGreetingLength {
+		return fmt.Errorf("rendered greeting is longer than %d characters", maxGreetingLength)
+	}
+
+	if err := validateMarkdownV2(rendered); err != nil {
+		return fmt.Errorf("invalid MarkdownV2: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Monitor) HandleSetGreetingCommand(uc *UpdateContext, template string) error {
+	uc.L().Info("handling set greeting command")
+
+	if err := validateGreetingTemplate(template); err != nil {
+		uc.L().Infof("rejecting greeting template: %v", err)
+		if _, err := uc.Bot().Reply(uc.Message(), uc.Lang().T(
+			i18n.GreetingRejected,
+			err,
+			strings.Join(greetingPlaceholders, ", "),
+		)); err != nil {
+			uc.L().Errorf("failed to send message: %v", err)
+		}
+		return nil
+	}
+
+	settings := uc.ChatState().EffectiveSettings(m.config.ChatDefaults())
+	preview := renderGreeting(template, newGreetingValues(
+		uc.Lang(),
+		senderName(uc),
+		uc.Sender().ID,
+		uc.Chat().Title,
+		settings.JoinLoginTimeout,
+		m.loginDeepLink(uc.Chat().ID),
+	))
+
+	// Telegram has the final word on the markup, so the template is saved only if the preview is accepted.
+	if _, err := uc.Bot().Reply(uc.Message(), preview, telebot.ModeMarkdownV2); err != nil {
+		uc.L().Infof("telegram rejected greeting preview: %v", err)
+		if _, err := uc.Bot().Reply(uc.Message(), uc.Lang().T(i18n.GreetingRejectedByTG, err)); err != nil {
+			uc.L().Errorf("failed to send message: %v", err)
+		}
+		return nil
+	}
+
+	uc.ChatState().Settings.GreetingTemplate = &template
+	if err := m.storage.UpdateChatSettings(uc, uc.ChatState()); err != nil {
+		return fmt.Errorf("updating chat settings: %w", err)
+	}
+
+	if _, err := uc.Bot().Reply(uc.Message(), uc.Lang().T(i18n.GreetingSaved)); err != nil {
+		uc.L().Errorf("failed to send message: %v", err)
+	}
+
+	return nil
+}
+
+func (m *Monitor) HandleResetGreetingCommand(uc *UpdateContext) error {
+	uc.L().Info("handling reset greeting command")
+
+	uc.ChatState().Settings.GreetingTemplate = nil
+	if err := m.storage.UpdateChatSettings(uc, uc.ChatState()); err != nil {
+		return fmt.Errorf("updating chat settings: %w", err)
+	}
+
+	if _, err := uc.Bot().Reply(uc.Message(), uc.Lang().T(i18n.GreetingReset)); err != nil {
+		uc.L().Errorf("failed to send message: %v", err)
+	}
+
+	return nil
+}
+
+func (m *Monitor) loginDeepLink(chatID int64) string {
+	return fmt.Sprintf("https://t.me/%s?start=%d", tgutil.Me(m.bot).Username, chatID)
+}
+
+func senderName(uc *UpdateContext) string {
+	return userName(uc.Sender())
+}
+
+func userName(user *telebot.User) string {
+	if user.FirstName != "" || user.LastName != "" {
+		return strings.TrimSpace(fmt.Sprintf("%s %s", user.FirstName, user.LastName))
+	}
+	return user.Username
+}
@@ -0,0 +1,176 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const markdownV2Reserved = "_*[]()~`>#+-=|{}.!"
+
+func escapeMarkdownV2(s string) string {
+	return strings.NewReplacer(
+		"_", "\\_",
+		"*", "\\*",
+		"[", "\\[",
+		"]", "\\]",
+		"(", "\\(",
+		")", "\\)",
+		"~", "\\~",
+		"`", "\\`",
+		">", "\\>",
+		"#", "\\#",
+		"+", "\\+",
+		"-", "\\-",
+		"=", "\\=",
+		"|", "\\|",
+		"{", "\\{",
+		"}", "\\}",
+		".", "\\.",
+		"!", "\\!",
+	).Replace(s)
+}
+
+// validateMarkdownV2 checks the text against the Telegram MarkdownV2 rules:
+// reserved characters must be escaped unless they are entity markers,
+// entities must be properly nested and closed, links must be well-formed.
+func validateMarkdownV2(text string) error {
+	if !utf8.ValidString(text) {
+		return errors.New("text is not valid UTF-8")
+	}
+
+	var stack []string
+	runes := []rune(text)
+
+	top := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		return stack[len(stack)-1]
+	}
+
+	toggle := func(marker string, pos int) error {
+		if top() == marker {
+			stack = stack[:len(stack)-1]
+			return nil
+		}
+		for _, open := range stack {
+			if open == marker {
+				return fmt.Errorf("entity %q at position %d closes before inner %q", marker, pos, top())
+			}
+		}
+		stack = append(stack, marker)
+		return nil
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		lineStart := i == 0 || runes[i-1] == '\n'
+
+		switch {
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return errors.New("text ends with a lone backslash")
+			}
+			i++
+
+		case r == '`':
+			n := 1
+			if i+2 < len(runes) && runes[i+1] == '`' && runes[i+2] == '`' {
+				n = 3
+			}
+			end, err := scanCode(runes, i+n, n)
+			if err != nil {
+				return fmt.Errorf("code at position %d: %w", i, err)
+			}
+			i = end + n - 1
+
+		case r == '_' && i+1 < len(runes) && runes[i+1] == '_':
+			if err := toggle("__", i); err != nil {
+				return err
+			}
+			i++
+
+		case r == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			if err := toggle("||", i); err != nil {
+				return err
+			}
+			i++
+
+		case r == '*' || r == '_' || r == '~':
+			if r == '*' && lineStart && strings.HasPrefix(string(runes[i:]), "**>") {
+				i += 2
+				continue
+			}
+			if err := toggle(string(r), i); err != nil {
+				return err
+			}
+
+		case r == '>' && lineStart:
+			// Block quotation.
+
+		case r == '!' && i+1 < len(runes) && runes[i+1] == '[':
+			// Custom emoji, the link part is validated below.
+
+		case r == '[':
+			stack = append(stack, "[")
+
+		case r == ']':
+			if top() != "[" {
+				return fmt.Errorf("unexpected ']' at position %d", i)
+			}
+			stack = stack[:len(stack)-1]
+
+			if i+1 >= len(runes) || runes[i+1] != '(' {
+				return fmt.Errorf("link text at position %d is not followed by a url", i)
+			}
+			end, err := scanLinkURL(runes, i+2)
+			if err != nil {
+				return fmt.Errorf("link at position %d: %w", i, err)
+			}
+			i = end
+
+		case strings.ContainsRune(markdownV2Reserved, r):
+			return fmt.Errorf("character %q at position %d must be escaped with a backslash", r, i)
+		}
+	}
+
+	if len(stack) != 0 {
+		return fmt.Errorf("unclosed entity %q", top())
+	}
+
+	return nil
+}
+
+// scanCode returns the position of the closing marker of n backticks for the code starting at start.
+func scanCode(runes []rune, start, n int) (int, error) {
+	for i := start; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\':
+			if i+1 >= len(runes) {
+				return 0, errors.New("lone backslash")
+			}
+			i++
+		case runes[i] == '`' && (n == 1 || (i+2 < len(runes) && runes[i+1] == '`' && runes[i+2] == '`')):
+			return i, nil
+		}
+	}
+	return 0, errors.New("unclosed code")
+}
+
+// scanLinkURL returns the position of the closing parenthesis of the link url starting at start.
+func scanLinkURL(runes []rune, start int) (int, error) {
+	for i := start; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case ')':
+			if i == start {
+				return 0, errors.New("empty url")
+			}
+			return i, nil
+		}
+	}
+	return 0, errors.New("unclosed url")
+}
@@ -0,0 +1,315 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"gopkg.in/telebot.v4"
+)
+
+type moderationAction string
+
+const (
+	moderationBan   moderationAction = "ban"
+	moderationKick  moderationAction = "kick"
+	moderationMute  moderationAction = "mute"
+	moderationUnban moderationAction = "unban"
+)
+
+var (
+	errNoTarget            = errors.New("no target")
+	errUnknownUser         = errors.New("unknown username")
+	errPendingVerification = errors.New("user is pending verification")
+)
+
+// moderationTarget is the user a moderation command is applied to.
+type moderationTarget struct {
+	id   int64
+	name string
+}
+
+func (t moderationTarget) String() string {
+	if t.name == "" {
+		return strconv.FormatInt(t.id, 10)
+	}
+	return fmt.Sprintf("%s (%d)", t.name, t.id)
+}
+
+// HandleModerationCommand applies the action to the user replied to or passed as @username or id.
+// The command is deleted and replaced with a confirmation naming the target and the admin.
+func (m *Monitor) HandleModerationCommand(uc *UpdateContext, action moderationAction, args string) error {
+	uc.L().Infof("handling %v command", action)
+
+	target, rest, ok, err := m.resolveModerationTarget(uc, string(action), args)
+	if err != nil {
+		return fmt.Errorf("resolving target: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	var muteFor time.Duration
+	if action == moderationMute {
+		if muteFor, err = parseMuteDuration(rest); err != nil {
+			uc.L().Infof("bad mute duration %q: %v", rest, err)
+			m.replyCommand(uc, uc.Lang().T(i18n.ModerationBadDuration))
+			return nil
+		}
+	}
+
+	user, err := m.moderationUser(uc, target)
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+
+	if err := m.moderate(uc, action, user, muteFor); errors.Is(err, errPendingVerification) {
+		uc.L().Infof("not muting user %v pending verification", target)
+		m.replyCommand(uc, uc.Lang().T(i18n.ModerationMutePending, target))
+		return nil
+	} else if err != nil {
+		uc.L().Warnf("telegram rejected %v of user %v: %v", action, target, err)
+		m.replyCommand(uc, uc.Lang().T(i18n.ModerationFailed, err))
+		return nil
+	}
+
+	var confirmation string
+	switch action {
+	case moderationBan:
+		confirmation = uc.Lang().T(i18n.ModerationBanned, target, senderName(uc))
+	case moderationKick:
+		confirmation = uc.Lang().T(i18n.ModerationKicked, target, senderName(uc))
+	case moderationMute:
+		confirmation = uc.Lang().T(i18n.ModerationMuted, target, uc.Lang().Duration(muteFor), senderName(uc))
+	case moderationUnban:
+		confirmation = uc.Lang().T(i18n.ModerationUnbanned, target, senderName(uc))
+	}
+
+	m.deleteMessageChecked(uc.Message(), uc.L())
+
+	if err := uc.Send(confirmation); err != nil {
+		return fmt.Errorf("sending confirmation: %w", err)
+	}
+
+	return nil
+}
+
+// HandleAcceptCommand lets in a user pending verification, like the accept button of the greeting.
+// Users who joined during a raid have no greeting, so admins accept them with the command.
+func (m *Monitor) HandleAcceptCommand(uc *UpdateContext, args string) error {
+	uc.L().Info("handling accept command")
+
+	target, _, ok, err := m.resolveModerationTarget(uc, "accept", args)
+	if err != nil {
+		return fmt.Errorf("resolving target: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	user, err := m.storage.GetChatUser(uc, uc.Chat().ID, target.id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("getting user: %w", err)
+	}
+	if err != nil || (user.Status != models.UserStatusJustJoined && user.Status != models.UserStatusJoinRequested) {
+		m.replyCommand(uc, uc.Lang().T(i18n.ModerationNotPending, target))
+		return nil
+	}
+
+	if err := m.acceptMember(uc, user); err != nil {
+		return fmt.Errorf("accepting user: %w", err)
+	}
+
+	m.deleteMessageChecked(uc.Message(), uc.L())
+
+	if err := uc.Send(uc.Lang().T(i18n.ModerationAccepted, target, senderName(uc))); err != nil {
+		return fmt.Errorf("sending confirmation: %w", err)
+	}
+
+	return nil
+}
+
+// moderationUser returns the target's record. Users never seen in the chat are created as kicked,
+// so they still have to pass the verification when they join.
+func (m *Monitor) moderationUser(uc *UpdateContext, target moderationTarget) (*models.User, error) {
+	return m.storage.GetOrCreateUser(uc, uc.Chat().ID, target.id, models.UserStatusKicked)
+}
+
+// moderate applies the action in Telegram and updates the user's status.
+// Only the Telegram error is returned, storage errors are logged.
+// Users pending verification aren't muted, the mute would lift their verification restriction when it expires.
+func (m *Monitor) moderate(uc *UpdateContext, action moderationAction, user *models.User, muteFor time.Duration) error {
+	logger := uc.L().WithField("target.telegram_id", user.TelegramID)
+
+	chat := &telebot.Chat{ID: user.ChatID}
+	tgUser := &telebot.User{ID: user.TelegramID}
+
+	var (
+		status models.UserStatus
+		err    error
+	)
+	switch action {
+	case moderationBan:
+		err = m.bot.Ban(chat, &telebot.ChatMember{User: tgUser})
+		status = models.UserStatusBanned
+
+	case moderationKick:
+		// Unbanning a member removes them from the chat without banning,
+		// verified members don't have to verify again when they come back.
+		err = m.bot.Unban(chat, tgUser)
+		status = unbannedStatus(user)
+
+	case moderationMute:
+		if user.Restricted || user.Status == models.UserStatusJustJoined || user.Status == models.UserStatusJoinRequested {
+			return errPendingVerification
+		}
+		err = m.bot.Restrict(chat, &telebot.ChatMember{
+			User:            tgUser,
+			Rights:          telebot.NoRights(),
+			RestrictedUntil: time.Now().Add(muteFor).Unix(),
+		})
+
+	case moderationUnban:
+		err = m.bot.Unban(chat, tgUser, true)
+		status = unbannedStatus(user)
+	}
+	if err != nil {
+		return err
+	}
+
+	if status != "" {
+		if err := m.storage.SetUserStatus(uc, user.ID, status); err != nil {
+			logger.Errorf("failed to set user status: %v", err)
+		}
+	}
+
+	if action == moderationBan || action == moderationKick {
+		if err := m.storage.CancelVerificationDeadline(uc, user.ID); err != nil {
+			logger.Errorf("failed to cancel verification deadline: %v", err)
+		}
+		m.forgetLoginLinks(uc, logger, user)
+		if err := m.removeGreetingsForUser(uc, user); err != nil {
+			logger.Errorf("failed to remove greetings for user: %v", err)
+		}
+	}
+
+	switch action {
+	case moderationBan:
+		m.propagateFederationBan(uc, user)
+	case moderationUnban:
+		m.propagateFederationUnban(uc, user)
+	}
+
+	logger.Infof("applied %v", action)
+	metrics.AdminActions.WithLabelValues(string(action)).Inc()
+
+	return nil
+}
+
+// unbannedStatus is the status of the user after an unban or a kick,
+// users who never logged in have to pass the verification when they join again.
+func unbannedStatus(user *models.User) models.UserStatus {
+	if user.CTFTimeUserID != 0 {
+		return models.UserStatusActive
+	}
+	return models.UserStatusKicked
+}
+
+// resolveModerationTarget resolves the target of the command, answering the admin if it's missing or not allowed.
+func (m *Monitor) resolveModerationTarget(
+	uc *UpdateContext,
+	command string,
+	args string,
+) (moderationTarget, string, bool, error) {
+	target, rest, err := m.moderationTarget(uc, args)
+	switch {
+	case errors.Is(err, errNoTarget):
+		m.replyCommand(uc, uc.Lang().T(i18n.ModerationNoTarget, command))
+		return moderationTarget{}, "", false, nil
+	case errors.Is(err, errUnknownUser):
+		m.replyCommand(uc, uc.Lang().T(i18n.ModerationUnknownUser, strings.Fields(args)[0]))
+		return moderationTarget{}, "", false, nil
+	case err != nil:
+		return moderationTarget{}, "", false, err
+	}
+
+	if target.id == uc.Sender().ID || slices.ContainsFunc(uc.ChatState().Admins, func(admin telebot.ChatMember) bool {
+		return admin.User != nil && admin.User.ID == target.id
+	}) {
+		m.replyCommand(uc, uc.Lang().T(i18n.ModerationTargetAdmin))
+		return moderationTarget{}, "", false, nil
+	}
+
+	return target, rest, true, nil
+}
+
+// moderationTarget resolves the target from the replied message or the first argument,
+// returning the rest of the arguments.
+func (m *Monitor) moderationTarget(uc *UpdateContext, args string) (moderationTarget, string, error) {
+	if reply := uc.Message().ReplyTo; reply != nil && reply.Sender != nil && !reply.Sender.IsBot {
+		return moderationTarget{id: reply.Sender.ID, name: userName(reply.Sender)}, args, nil
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return moderationTarget{}, "", errNoTarget
+	}
+	first, rest := fields[0], strings.Join(fields[1:], " ")
+
+	if username, ok := strings.CutPrefix(first, "@"); ok {
+		user, err := m.storage.GetChatUserByUsername(uc, uc.Chat().ID, username)
+		if errors.Is(err, storage.ErrNotFound) {
+			return moderationTarget{}, "", errUnknownUser
+		}
+		if err != nil {
+			return moderationTarget{}, "", fmt.Errorf("getting user by username: %w", err)
+		}
+		return moderationTarget{id: user.TelegramID, name: first}, rest, nil
+	}
+
+	id, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || id <= 0 {
+		return moderationTarget{}, "", errNoTarget
+	}
+
+	target := moderationTarget{id: id}
+	if member, err := m.bot.ChatMemberOf(uc.Chat(), &telebot.User{ID: id}); err == nil && member.User != nil {
+		target.name = userName(member.User)
+	}
+	return target, rest, nil
+}
+
+func (m *Monitor) replyCommand(uc *UpdateContext, text string) {
+	if _, err := uc.Bot().Reply(uc.Message(), text); err != nil {
+		uc.L().Errorf("failed to send message: %v", err)
+	}
+}
+
+// parseMuteDuration parses Go durations and whole days, like 30m, 2h or 7d.
+func parseMuteDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid number of days %q", days)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("parsing duration: %w", err)
+	}
+	if d < time.Minute {
+		// Telegram treats restrictions shorter than 30 seconds as permanent.
+		return 0, fmt.Errorf("duration %v is shorter than a minute", d)
+	}
+	return d, nil
+}
@@ -0,0 +1,36 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMuteDuration(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{in: "30m", want: 30 * time.Minute, ok: true},
+		{in: " 2h ", want: 2 * time.Hour, ok: true},
+		{in: "1h30m", want: 90 * time.Minute, ok: true},
+		{in: "7d", want: 7 * 24 * time.Hour, ok: true},
+		{in: "1m", want: time.Minute, ok: true},
+		// Telegram makes restrictions shorter than 30 seconds permanent.
+		{in: "30s"},
+		{in: "0d"},
+		{in: "-1d"},
+		{in: "1.5d"},
+		{in: "d"},
+		{in: ""},
+		{in: "forever"},
+	} {
+		got, err := parseMuteDuration(tc.in)
+		if tc.ok && (err != nil || got != tc.want) {
+			t.Errorf("parseMuteDuration(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("parseMuteDuration(%q) = %v, want an error", tc.in, got)
+		}
+	}
+}
@@ -11,12 +11,23 @@ import (
 
 	"github.com/C4T-BuT-S4D/shpaga/internal/authutil"
 	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
 	"github.com/C4T-BuT-S4D/shpaga/internal/models"
 	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgutil"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/telebot.v4"
 )
 
+const (
+	// deadlineLease is how long a claimed deadline is kept from other cleaners,
+	// it's claimed again after the lease if the cleaner died while processing it.
+	deadlineLease = 5 * time.Minute
+	// deadlineRetryDelay is how long a deadline that failed to be processed waits for the next attempt.
+	deadlineRetryDelay = time.Minute
+)
+
 var allowedChatTypes = []telebot.ChatType{
 	telebot.ChatGroup,
 	telebot.ChatSuperGroup,
@@ -25,11 +36,11 @@ var allowedChatTypes = []telebot.ChatType{
 
 type Monitor struct {
 	config  *config.Config
-	storage *storage.Storage
+	storage storage.Storage
 	bot     telebot.API
 }
 
-func New(cfg *config.Config, storage *storage.Storage, bot telebot.API) *Monitor {
+func New(cfg *config.Config, storage storage.Storage, bot telebot.API) *Monitor {
 	return &Monitor{
 		config:  cfg,
 		storage: storage,
@@ -38,6 +49,10 @@ func New(cfg *config.Config, storage *storage.Storage, bot telebot.API) *Monitor
 }
 
 func (m *Monitor) HandleAnyUpdate(c telebot.Context) error {
+	defer func(start time.Time) {
+		metrics.UpdateDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
 	ctx, cancel := context.WithTimeout(context.Background(), m.config.BotHandleTimeout)
 	defer cancel()
 
@@ -47,7 +62,7 @@ func (m *Monitor) HandleAnyUpdate(c telebot.Context) error {
 		return nil
 	}
 
-	uc := NewUpdateContext(ctx, c, chatState)
+	uc := NewUpdateContext(ctx, c, m.bot, chatState, m.updateLang(c, chatState))
 
 	if err := m.storage.UpdateLastUpdate(uc, c.Update().ID); err != nil {
 		uc.L().Errorf("failed to update last update: %v", err)
@@ -70,6 +85,8 @@ func (m *Monitor) HandleAnyUpdate(c telebot.Context) error {
 		)
 	case c.Callback() != nil:
 		uc.L().Debugf("received callback query update: callback=%v", c.Callback())
+	case c.ChatJoinRequest() != nil:
+		uc.L().Debugf("received chat join request update: request=%v", c.ChatJoinRequest())
 	default:
 		uc.L().Warnf("received unknown update %+v", c.Update())
 		return nil
@@ -88,7 +105,7 @@ func (m *Monitor) HandleAnyUpdate(c telebot.Context) error {
 		chatMemberLeft = isMemberStatus(member.OldChatMember) && isLeftStatus(member.NewChatMember)
 
 		if chatMemberJoined == chatMemberLeft {
-			uc.L().Warnf("unexpected member status, old=%v, new=%v", member.OldChatMember, member.NewChatMember)
+			uc.L().Debugf("member status change is neither join nor leave, old=%v, new=%v", member.OldChatMember, member.NewChatMember)
 		}
 	}
 
@@ -100,6 +117,16 @@ func (m *Monitor) HandleAnyUpdate(c telebot.Context) error {
 		}
 	}
 
+	// Admin commands are resolved once, checking the sender's rights.
+	var (
+		adminHandler   commandHandler
+		adminArgs      string
+		isAdminCommand bool
+	)
+	if uc.ChatState().IsGroup() && c.Message() != nil {
+		adminHandler, adminArgs, isAdminCommand = m.adminCommand(uc)
+	}
+
 	switch {
 	case c.Chat().Type == telebot.ChatPrivate:
 		if err := m.HandlePrivateMessage(uc); err != nil {
@@ -108,10 +135,18 @@ func (m *Monitor) HandleAnyUpdate(c telebot.Context) error {
 	case uc.ChatState().IsGroup() && c.Message() != nil && c.Message().UserJoined != nil:
 		if err := uc.Bot().Delete(uc.Message()); err != nil {
 			uc.L().Errorf("failed to delete join message: %v", err)
+		} else {
+			metrics.DeletedMessages.WithLabelValues("service").Inc()
 		}
 	case uc.ChatState().IsGroup() && c.Message() != nil && c.Message().UserLeft != nil:
 		if err := uc.Bot().Delete(uc.Message()); err != nil {
 			uc.L().Errorf("failed to delete left message: %v", err)
+		} else {
+			metrics.DeletedMessages.WithLabelValues("service").Inc()
+		}
+	case uc.ChatState().IsGroup() && c.ChatJoinRequest() != nil:
+		if err := m.HandleJoinRequest(uc); err != nil {
+			uc.L().Errorf("failed to handle chat join request: %v", err)
 		}
 	case chatMemberLeft:
 		if err := m.HandleMemberLeft(uc); err != nil {
@@ -129,6 +164,16 @@ func (m *Monitor) HandleAnyUpdate(c telebot.Context) error {
 		if err := m.HandleNewMemberCallbackAction(uc, CallbackActionNewMemberKick); err != nil {
 			uc.L().Errorf("failed to handle new member kick: %v", err)
 		}
+	case uc.ChatState().IsGroup() && c.Callback() != nil && CallbackActionSettings.DataMatches(c.Callback().Data):
+		if err := m.HandleSettingsCallbackAction(uc); err != nil {
+			uc.L().Errorf("failed to handle settings action: %v", err)
+		}
+	case isAdminCommand:
+		if err := adminHandler(m, uc, adminArgs); err != nil {
+			uc.L().Errorf("failed to handle admin command: %v", err)
+		}
+	case c.ChatMember() != nil:
+		uc.L().Debugf("ignoring chat member update")
 	default:
 		if err := m.HandleChatMessage(uc); err != nil {
 			uc.L().Errorf("failed to handle message: %v", err)
@@ -145,6 +190,7 @@ func (m *Monitor) HandleChatMessage(uc *UpdateContext) error {
 	}
 
 	uc.SetLoggerUser(user)
+	m.syncUsername(uc, user)
 
 	uc.L().Info("user sent message to chat")
 
@@ -152,6 +198,8 @@ func (m *Monitor) HandleChatMessage(uc *UpdateContext) error {
 		uc.L().Info("user just joined, removing message until user logs in")
 		if err := uc.Bot().Delete(uc.Message()); err != nil {
 			uc.L().Warnf("failed to delete message: %v", err)
+		} else {
+			metrics.DeletedMessages.WithLabelValues("unverified").Inc()
 		}
 	}
 
@@ -165,6 +213,7 @@ func (m *Monitor) HandleNewMember(uc *UpdateContext) error {
 	}
 
 	uc.L().Info("user joined")
+	metrics.Joins.WithLabelValues("member").Inc()
 
 	user, err := m.storage.GetOrCreateUser(uc, uc.Chat().ID, uc.Sender().ID, models.UserStatusJustJoined)
 	if err != nil {
@@ -172,6 +221,20 @@ func (m *Monitor) HandleNewMember(uc *UpdateContext) error {
 	}
 
 	uc.SetLoggerUser(user)
+	m.syncUsername(uc, user)
+
+	if m.isFederationBanned(uc) {
+		uc.L().Info("user is banned in the federation, removing without greeting")
+		if err := m.bot.Ban(uc.Chat(), &telebot.ChatMember{User: uc.Sender()}); err != nil {
+			return fmt.Errorf("banning user: %w", err)
+		}
+		if err := m.storage.SetUserStatus(uc, user.ID, models.UserStatusBanned); err != nil {
+			return fmt.Errorf("setting user status: %w", err)
+		}
+		m.forgetLoginLinks(uc, uc.L(), user)
+		metrics.FederationBans.WithLabelValues("join").Inc()
+		return nil
+	}
 
 	if user.Status == models.UserStatusKicked {
 		if err := m.storage.SetUserStatus(uc, user.ID, models.UserStatusJustJoined); err != nil {
@@ -182,63 +245,91 @@ func (m *Monitor) HandleNewMember(uc *UpdateContext) error {
 
 	switch user.Status {
 	case models.UserStatusJustJoined:
-		uc.L().Info("user just joined, sending welcome message")
+		settings := uc.ChatState().EffectiveSettings(m.config.ChatDefaults())
 
-		name := ""
-		if uc.Sender().FirstName != "" || uc.Sender().LastName != "" {
-			name = fmt.Sprintf("%s %s", uc.Sender().FirstName, uc.Sender().LastName)
-		} else {
-			name = uc.Sender().Username
+		if verified := m.trustedVerification(uc, settings); verified != nil {
+			if trusted, err := m.acceptTrustedMember(uc, user, verified, settings); trusted || err != nil {
+				return err
+			}
 		}
-		name = escapeMarkdownV2(name)
 
-		botName := uc.Bot().(*telebot.Bot).Me.Username
-		url := fmt.Sprintf("t.me/%s?start=%d", botName, user.ChatID)
+		m.restrictNewMember(uc, user)
 
-		greeting := fmt.Sprintf(
-			`Welcome to the chat, [%s](tg://user?id=%d)\! `+
-				`Please, press the button below, start the bot and follow the instructions `+
-				`to log in with [CTFTime](https://ctftime.org)\. `+
-				`You won't be able to send messages until you do so\. `+
-				`The bot will kick you in %d minutes if you don't login\.`,
-			name,
+		if m.registerJoin(uc, settings) {
+			uc.L().Info("user joined during a raid, skipping the welcome message")
+			if err := m.storage.ScheduleVerificationDeadline(uc, user.ID, time.Now().Add(settings.JoinLoginTimeout)); err != nil {
+				return fmt.Errorf("scheduling verification deadline: %w", err)
+			}
+			return nil
+		}
+
+		uc.L().Info("user just joined, sending welcome message")
+
+		url := m.loginDeepLink(user.ChatID)
+
+		greeting := renderGreeting(greetingTemplate(settings, uc.Lang()), newGreetingValues(
+			uc.Lang(),
+			senderName(uc),
 			uc.Sender().ID,
-			m.config.JoinLoginTimeout/time.Minute,
-		)
+			uc.Chat().Title,
+			settings.JoinLoginTimeout,
+			url,
+		))
+
 		markup := &telebot.ReplyMarkup{}
-		markup.Inline(
-			markup.Row(
-				markup.URL("Log in with CTFTime", url),
-			),
-			markup.Row(
+		var rows []telebot.Row
+		if settings.VerificationProvider == models.VerificationProviderCTFTime {
+			rows = append(rows, markup.Row(
+				markup.URL(uc.Lang().T(i18n.LoginButton), url),
+			))
+		}
+		if settings.ShowAdminButtons || settings.VerificationProvider == models.VerificationProviderAdmin {
+			rows = append(rows, markup.Row(
 				markup.Data(
-					"✅ Accept (admin only)",
+					uc.Lang().T(i18n.AcceptButton),
 					CallbackActionNewMemberAccept.String(),
 					strconv.FormatInt(uc.Sender().ID, 10),
 				),
 				markup.Data(
-					"❌ Kick (admin only)",
+					uc.Lang().T(i18n.KickButton),
 					CallbackActionNewMemberKick.String(),
 					strconv.FormatInt(uc.Sender().ID, 10),
 				),
-			),
-		)
+			))
+		}
+		markup.Inline(rows...)
+
 		msg, err := uc.Bot().Send(uc.Chat(), greeting, markup, telebot.ModeMarkdownV2)
 		if err != nil {
 			return fmt.Errorf("sending welcome message: %w", err)
 		}
 
+		expiresAt := time.Now().Add(settings.JoinLoginTimeout)
+		if err := m.storage.ScheduleVerificationDeadline(uc, user.ID, expiresAt); err != nil {
+			return fmt.Errorf("scheduling verification deadline: %w", err)
+		}
 		if err := m.storage.AddMessage(uc, &models.Message{
 			ChatID:           uc.Chat().ID,
 			MessageID:        strconv.Itoa(msg.ID),
 			MessageType:      models.MessageTypeGreeting,
 			AssociatedUserID: user.ID,
+			ExpiresAt:        &expiresAt,
 		}); err != nil {
 			return fmt.Errorf("adding welcome message to db: %w", err)
 		}
 
 		return nil
 
+	case models.UserStatusJoinRequested:
+		uc.L().Info("join request was approved by an admin, accepting user")
+		if err := m.storage.SetUserStatus(uc, user.ID, models.UserStatusActive); err != nil {
+			return fmt.Errorf("setting user status: %w", err)
+		}
+		if err := m.storage.CancelVerificationDeadline(uc, user.ID); err != nil {
+			uc.L().Errorf("failed to cancel verification deadline: %v", err)
+		}
+		return nil
+
 	case models.UserStatusActive:
 		uc.L().Info("user already logged in")
 		return nil
@@ -282,7 +373,7 @@ func (m *Monitor) HandlePrivateMessage(uc *UpdateContext) error {
 	chatID, err := strconv.ParseInt(tokens[1], 10, 64)
 	if err != nil {
 		uc.L().Errorf("failed to parse chat id: %v", err)
-		if err := uc.TC().Send("Invalid chat id"); err != nil {
+		if err := uc.Send(uc.Lang().T(i18n.InvalidChatID)); err != nil {
 			uc.L().Errorf("failed to send message: %v", err)
 		}
 		return nil
@@ -295,27 +386,37 @@ func (m *Monitor) HandlePrivateMessage(uc *UpdateContext) error {
 
 	uc.SetLoggerUser(user)
 
-	if user.Status != models.UserStatusJustJoined {
+	if user.Status != models.UserStatusJustJoined && user.Status != models.UserStatusJoinRequested {
 		uc.L().Warnf("user status is not just joined, ignoring")
-		if err := uc.TC().Send(
-			fmt.Sprintf("You have an unexpected status `%s`", user.Status),
-			telebot.ModeMarkdownV2,
-		); err != nil {
+		if err := uc.Send(uc.Lang().T(i18n.UnexpectedStatus, user.Status)); err != nil {
 			uc.L().Errorf("failed to send message: %v", err)
 		}
 		return nil
 	}
 
-	url, err := authutil.GetCTFTimeOAuthURL(user.ID, user.ChatID, m.config)
+	chatState, err := m.storage.GetChatState(uc, user.ChatID)
 	if err != nil {
-		return fmt.Errorf("getting oauth url: %w", err)
+		return fmt.Errorf("getting chat state: %w", err)
+	}
+
+	if chatState.EffectiveSettings(m.config.ChatDefaults()).VerificationProvider != models.VerificationProviderCTFTime {
+		uc.L().Info("chat does not use CTFTime verification, ignoring")
+		if err := uc.Send(uc.Lang().T(i18n.AdminVerificationOnly)); err != nil {
+			uc.L().Errorf("failed to send message: %v", err)
+		}
+		return nil
 	}
 
-	text := "Follow the link below to log in with CTFTime"
+	url, err := m.createLoginURL(uc, user)
+	if err != nil {
+		return fmt.Errorf("creating login url: %w", err)
+	}
+
+	text := uc.Lang().T(i18n.FollowLoginLink)
 	markup := &telebot.ReplyMarkup{}
-	markup.Inline(markup.Row(markup.URL("Log in with CTFTime", url)))
+	markup.Inline(markup.Row(markup.URL(uc.Lang().T(i18n.LoginButton), url)))
 
-	if err := uc.TC().Send(text, markup); err != nil {
+	if err := uc.Send(text, markup); err != nil {
 		return fmt.Errorf("sending login message: %w", err)
 	}
 
@@ -326,13 +427,125 @@ func (m *Monitor) HandlePrivateMessage(uc *UpdateContext) error {
 	return nil
 }
 
+// HandleJoinRequest sends the login link to the requester,
+// the request is approved after the OAuth callback and declined by the cleaner on timeout.
+func (m *Monitor) HandleJoinRequest(uc *UpdateContext) error {
+	settings := uc.ChatState().EffectiveSettings(m.config.ChatDefaults())
+	if !settings.JoinRequestsEnabled || settings.VerificationProvider != models.VerificationProviderCTFTime {
+		uc.L().Debug("join requests handling is disabled, leaving request to admins")
+		return nil
+	}
+
+	if uc.Sender().IsBot {
+		uc.L().Info("bot requested to join, ignoring")
+		return nil
+	}
+
+	uc.L().Info("user requested to join")
+	metrics.Joins.WithLabelValues("join_request").Inc()
+
+	user, err := m.storage.GetOrCreateUser(uc, uc.Chat().ID, uc.Sender().ID, models.UserStatusJoinRequested)
+	if err != nil {
+		return fmt.Errorf("get or create user: %w", err)
+	}
+
+	uc.SetLoggerUser(user)
+	m.syncUsername(uc, user)
+
+	if m.isFederationBanned(uc) {
+		uc.L().Info("user is banned in the federation, declining request")
+		if err := uc.Bot().DeclineJoinRequest(uc.Chat(), uc.Sender()); err != nil {
+			return fmt.Errorf("declining join request: %w", err)
+		}
+		if err := m.storage.SetUserStatus(uc, user.ID, models.UserStatusBanned); err != nil {
+			return fmt.Errorf("setting user status: %w", err)
+		}
+		m.forgetLoginLinks(uc, uc.L(), user)
+		metrics.FederationBans.WithLabelValues("join_request").Inc()
+		return nil
+	}
+
+	if user.Status == models.UserStatusKicked || user.Status == models.UserStatusJustJoined {
+		if err := m.storage.SetUserStatus(uc, user.ID, models.UserStatusJoinRequested); err != nil {
+			return fmt.Errorf("setting user status: %w", err)
+		}
+		user.Status = models.UserStatusJoinRequested
+	}
+
+	switch user.Status {
+	case models.UserStatusJoinRequested:
+		if verified := m.trustedVerification(uc, settings); verified != nil {
+			trusted, err := m.trustVerification(uc, user, verified, settings)
+			if err != nil {
+				return err
+			}
+			if trusted {
+				if err := uc.Bot().ApproveJoinRequest(uc.Chat(), uc.Sender()); err != nil {
+					return fmt.Errorf("approving join request: %w", err)
+				}
+				return nil
+			}
+		}
+
+		url, err := m.createLoginURL(uc, user)
+		if err != nil {
+			return fmt.Errorf("creating login url: %w", err)
+		}
+
+		lang := uc.UserLang()
+		text := lang.T(i18n.JoinRequestLogin, uc.Chat().Title, lang.Duration(settings.JoinLoginTimeout))
+		markup := &telebot.ReplyMarkup{}
+		markup.Inline(markup.Row(markup.URL(lang.T(i18n.LoginButton), url)))
+
+		msg, err := uc.Bot().Send(&telebot.User{ID: uc.ChatJoinRequest().UserChatID}, text, markup)
+		if err != nil {
+			uc.L().Warnf("failed to send login link to requester, leaving request to admins: %v", err)
+			return nil
+		}
+
+		expiresAt := time.Now().Add(settings.JoinLoginTimeout)
+		if err := m.storage.ScheduleVerificationDeadline(uc, user.ID, expiresAt); err != nil {
+			return fmt.Errorf("scheduling verification deadline: %w", err)
+		}
+		if err := m.storage.AddMessage(uc, &models.Message{
+			ChatID:           msg.Chat.ID,
+			MessageID:        strconv.Itoa(msg.ID),
+			MessageType:      models.MessageTypeJoinRequest,
+			AssociatedUserID: user.ID,
+			ExpiresAt:        &expiresAt,
+		}); err != nil {
+			return fmt.Errorf("adding join request message to db: %w", err)
+		}
+
+		return nil
+
+	case models.UserStatusActive:
+		uc.L().Info("user already logged in, approving request")
+		if err := uc.Bot().ApproveJoinRequest(uc.Chat(), uc.Sender()); err != nil {
+			return fmt.Errorf("approving join request: %w", err)
+		}
+		return nil
+
+	case models.UserStatusBanned:
+		uc.L().Info("user is banned, declining request")
+		if err := uc.Bot().DeclineJoinRequest(uc.Chat(), uc.Sender()); err != nil {
+			return fmt.Errorf("declining join request: %w", err)
+		}
+		return nil
+
+	default:
+		uc.L().Warnf("user has unexpected status %v, leaving request to admins", user.Status)
+		return nil
+	}
+}
+
 func (m *Monitor) HandleNewMemberCallbackAction(uc *UpdateContext, action CallbackAction) error {
 	uc.L().Infof("handling new member callback action %v, data %v", action, uc.Callback().Data)
 
 	if err := m.checkSenderAdmin(uc); err != nil {
 		uc.L().Warnf("sender is not an admin: %v", err)
-		if err := uc.TC().Respond(&telebot.CallbackResponse{
-			Text: fmt.Sprintf("you are not an admin: %v", err),
+		if err := uc.Respond(&telebot.CallbackResponse{
+			Text: uc.Lang().T(i18n.NotAdmin, err),
 		}); err != nil {
 			uc.L().Errorf("failed to respond: %v", err)
 		}
@@ -342,7 +555,7 @@ func (m *Monitor) HandleNewMemberCallbackAction(uc *UpdateContext, action Callba
 	tokens := strings.SplitN(uc.Callback().Data, "|", 2)
 	if len(tokens) != 2 {
 		uc.L().Warnf("unexpected callback data: %v", uc.Callback().Data)
-		if err := uc.TC().Respond(&telebot.CallbackResponse{Text: "bad callback data"}); err != nil {
+		if err := uc.Respond(&telebot.CallbackResponse{Text: uc.Lang().T(i18n.BadCallbackData)}); err != nil {
 			uc.L().Errorf("failed to respond: %v", err)
 		}
 		return nil
@@ -351,7 +564,7 @@ func (m *Monitor) HandleNewMemberCallbackAction(uc *UpdateContext, action Callba
 	targetUserID, err := strconv.ParseInt(tokens[1], 10, 64)
 	if err != nil {
 		uc.L().Warnf("failed to parse target user id: %v", err)
-		if err := uc.TC().Respond(&telebot.CallbackResponse{Text: "bad user id"}); err != nil {
+		if err := uc.Respond(&telebot.CallbackResponse{Text: uc.Lang().T(i18n.BadUserID)}); err != nil {
 			uc.L().Errorf("failed to respond: %v", err)
 		}
 		return nil
@@ -364,7 +577,7 @@ func (m *Monitor) HandleNewMemberCallbackAction(uc *UpdateContext, action Callba
 
 	if user.Status != models.UserStatusJustJoined {
 		uc.L().Warnf("user status is not just joined, ignoring")
-		if err := uc.TC().Respond(&telebot.CallbackResponse{Text: "user status is not just joined"}); err != nil {
+		if err := uc.Respond(&telebot.CallbackResponse{Text: uc.Lang().T(i18n.UserNotJustJoined)}); err != nil {
 			uc.L().Errorf("failed to respond: %v", err)
 		}
 		return nil
@@ -372,9 +585,7 @@ func (m *Monitor) HandleNewMemberCallbackAction(uc *UpdateContext, action Callba
 
 	switch action {
 	case CallbackActionNewMemberAccept:
-		if err := m.storage.SetUserStatus(uc, user.ID, models.UserStatusActive); err != nil {
-			return fmt.Errorf("setting user status: %w", err)
-		}
+		return m.acceptMember(uc, user)
 
 	case CallbackActionNewMemberKick:
 		if err := m.bot.Unban(uc.Chat(), &telebot.User{ID: targetUserID}); err != nil {
@@ -383,6 +594,12 @@ func (m *Monitor) HandleNewMemberCallbackAction(uc *UpdateContext, action Callba
 		if err := m.storage.SetUserStatus(uc, user.ID, models.UserStatusKicked); err != nil {
 			return fmt.Errorf("setting user status: %w", err)
 		}
+		m.forgetLoginLinks(uc, uc.L(), user)
+		metrics.AdminActions.WithLabelValues("kick").Inc()
+	}
+
+	if err := m.storage.CancelVerificationDeadline(uc, user.ID); err != nil {
+		uc.L().Errorf("failed to cancel verification deadline: %v", err)
 	}
 
 	if err := m.removeGreetingsForUser(uc, user); err != nil {
@@ -392,6 +609,121 @@ func (m *Monitor) HandleNewMemberCallbackAction(uc *UpdateContext, action Callba
 	return nil
 }
 
+// updateLang chooses the language for the chat: from settings for groups and from the sender otherwise.
+func (m *Monitor) updateLang(c telebot.Context, chatState *models.ChatState) i18n.Lang {
+	fallback := i18n.ParseOr(m.config.Language, i18n.Default)
+	if chatState.IsGroup() {
+		return i18n.ParseOr(chatState.EffectiveSettings(m.config.ChatDefaults()).Language, fallback)
+	}
+	if c.Sender() != nil {
+		return i18n.ParseOr(c.Sender().LanguageCode, fallback)
+	}
+	return fallback
+}
+
+func (m *Monitor) createLoginURL(uc *UpdateContext, user *models.User) (string, error) {
+	codeVerifier := ""
+	if m.config.CTFTimePKCE {
+		var err error
+		if codeVerifier, err = authutil.NewCodeVerifier(); err != nil {
+			return "", fmt.Errorf("generating code verifier: %w", err)
+		}
+	}
+
+	state := authutil.NewState(user.ID, user.ChatID)
+	state.Lang = string(uc.UserLang())
+	if err := m.storage.AddOAuthState(uc, &models.OAuthState{
+		Nonce:        state.Nonce,
+		UserID:       user.ID,
+		CodeVerifier: codeVerifier,
+	}); err != nil {
+		return "", fmt.Errorf("adding oauth state: %w", err)
+	}
+
+	url, err := authutil.GetCTFTimeOAuthURL(state, codeVerifier, m.config)
+	if err != nil {
+		return "", fmt.Errorf("getting oauth url: %w", err)
+	}
+
+	return url, nil
+}
+
+// restrictNewMember forbids the user from sending messages until verification.
+// If the bot lacks the right, messages are deleted by HandleChatMessage instead.
+func (m *Monitor) restrictNewMember(uc *UpdateContext, user *models.User) {
+	if !tgutil.CanRestrict(uc.ChatState().Member) {
+		uc.L().Info("bot can't restrict members, falling back to deleting messages")
+		return
+	}
+
+	if err := tgutil.RestrictMember(m.bot, user.ChatID, user.TelegramID); err != nil {
+		uc.L().Warnf("failed to restrict user, falling back to deleting messages: %v", err)
+		return
+	}
+
+	if err := m.storage.SetUserRestricted(uc, user.ID, true); err != nil {
+		uc.L().Errorf("failed to mark user as restricted: %v", err)
+	}
+}
+
+// acceptMember lets the pending user in on behalf of an admin.
+func (m *Monitor) acceptMember(uc *UpdateContext, user *models.User) error {
+	if err := m.storage.SetUserStatus(uc, user.ID, models.UserStatusActive); err != nil {
+		return fmt.Errorf("setting user status: %w", err)
+	}
+
+	if user.Status == models.UserStatusJoinRequested {
+		if err := m.bot.ApproveJoinRequest(
+			&telebot.Chat{ID: user.ChatID},
+			&telebot.User{ID: user.TelegramID},
+		); err != nil {
+			uc.L().Errorf("failed to approve join request: %v", err)
+		}
+	}
+
+	m.liftRestrictions(uc, user)
+	metrics.AdminActions.WithLabelValues("accept").Inc()
+	metrics.Verifications.WithLabelValues(string(models.VerificationProviderAdmin)).Inc()
+
+	if err := m.storage.CancelVerificationDeadline(uc, user.ID); err != nil {
+		uc.L().Errorf("failed to cancel verification deadline: %v", err)
+	}
+
+	if err := m.removeGreetingsForUser(uc, user); err != nil {
+		return fmt.Errorf("removing greetings for user: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Monitor) liftRestrictions(uc *UpdateContext, user *models.User) {
+	if !user.Restricted {
+		return
+	}
+
+	if err := tgutil.UnrestrictMember(m.bot, user.ChatID, user.TelegramID); err != nil {
+		uc.L().Errorf("failed to lift restrictions: %v", err)
+		return
+	}
+
+	if err := m.storage.SetUserRestricted(uc, user.ID, false); err != nil {
+		uc.L().Errorf("failed to mark user as unrestricted: %v", err)
+	}
+}
+
+// syncUsername saves the username of the sender if it has changed.
+func (m *Monitor) syncUsername(uc *UpdateContext, user *models.User) {
+	if user.Username == uc.Sender().Username {
+		return
+	}
+
+	if err := m.storage.SetUserUsername(uc, user.ID, uc.Sender().Username); err != nil {
+		uc.L().Errorf("failed to save username: %v", err)
+		return
+	}
+	user.Username = uc.Sender().Username
+}
+
 func (m *Monitor) removeGreetingsForUser(uc *UpdateContext, user *models.User) error {
 	msgs, err := m.storage.GetMessagesForUser(uc, user.ID, user.ChatID, models.MessageTypeGreeting)
 	if err != nil {
@@ -406,63 +738,179 @@ func (m *Monitor) removeGreetingsForUser(uc *UpdateContext, user *models.User) e
 }
 
 func (m *Monitor) RunCleaner(ctx context.Context) {
+	t := time.NewTicker(m.config.CleanerInterval)
+	defer t.Stop()
+
+	m.Clean(ctx)
+	for {
+		select {
+		case <-t.C:
+			m.Clean(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Clean removes users who didn't log in before the deadline and cleans up expired data.
+func (m *Monitor) Clean(ctx context.Context) {
 	logger := logrus.WithField("component", "monitor_cleaner")
 
-	run := func() {
-		msgs, err := m.storage.GetMessagesOlderThan(
-			ctx,
-			time.Now().Add(-m.config.JoinLoginTimeout),
-		)
+	if err := m.storage.DeleteOAuthStatesOlderThan(
+		ctx,
+		time.Now().Add(-m.config.OAuthStateTTL),
+	); err != nil {
+		logger.Errorf("failed to delete old oauth states: %v", err)
+	}
+
+	if err := m.storage.DeleteExpiredWarnings(ctx, time.Now()); err != nil {
+		logger.Errorf("failed to delete expired warnings: %v", err)
+	}
+
+	m.endQuietRaids(ctx, logger)
+
+	// Deadlines are processed in batches until none are due, so that removals are not delayed under load.
+	// They are leased before processing, so no database locks are held during Telegram calls,
+	// and deleted only once processed. Failed deadlines are retried later.
+	for ctx.Err() == nil {
+		deadlines, err := m.storage.ClaimDueVerificationDeadlines(ctx, time.Now(), deadlineLease)
 		if err != nil {
-			logger.Errorf("failed to get messages: %v", err)
-			return
+			logger.Errorf("failed to claim verification deadlines: %v", err)
+			break
 		}
-		if len(msgs) == 0 {
-			return
+		if len(deadlines) == 0 {
+			break
 		}
-
-		logger.Infof("fetched %d old messages, cleaning up", len(msgs))
-		for _, msg := range msgs {
-			if msg.MessageType == models.MessageTypeGreeting {
-				user, err := m.storage.GetUser(ctx, msg.AssociatedUserID)
-				if err != nil {
-					logger.Errorf("failed to get user: %v", err)
-				} else if user.Status == models.UserStatusJustJoined {
-					logger.Infof("removing user %v by timeout", user.TelegramID)
-
-					if err := m.bot.Unban(
-						&telebot.Chat{ID: user.ChatID},
-						&telebot.User{ID: user.TelegramID},
-					); err != nil {
-						logger.Errorf("failed to kick user %v: %v", user, err)
-					}
-
-					if err := m.storage.SetUserStatus(ctx, user.ID, models.UserStatusKicked); err != nil {
-						logger.Errorf("failed to update user to kicked %v: %v", user, err)
-					}
+		for _, deadline := range deadlines {
+			if err := m.handleVerificationDeadline(ctx, logger, deadline); err != nil {
+				logger.Errorf("failed to process %v, retrying later: %v", deadline, err)
+				if err := m.storage.ReleaseVerificationDeadline(ctx, deadline, time.Now().Add(deadlineRetryDelay)); err != nil {
+					logger.Errorf("failed to release %v: %v", deadline, err)
 				}
+				continue
+			}
+			if err := m.storage.CompleteVerificationDeadline(ctx, deadline); err != nil {
+				logger.Errorf("failed to complete %v: %v", deadline, err)
 			}
+		}
+		logger.Infof("processed %d verification deadlines", len(deadlines))
+	}
+
+	m.applyFederationActions(ctx, logger)
+
+	msgs, err := m.storage.GetExpiredMessages(
+		ctx,
+		time.Now(),
+		time.Now().Add(-m.config.JoinLoginTimeout),
+	)
+	if err != nil {
+		logger.Errorf("failed to get messages: %v", err)
+		return
+	}
+	if len(msgs) == 0 {
+		return
+	}
+
+	logger.Infof("fetched %d old messages, cleaning up", len(msgs))
+	for _, msg := range msgs {
+		m.deleteMessageChecked(msg, logger)
+	}
 
-			m.deleteMessageChecked(msg, logger)
+	if err := m.storage.DeleteMessages(ctx, msgs); err != nil {
+		logger.Errorf("failed to delete messages: %v", err)
+	}
+}
+
+// handleVerificationDeadline removes the user if they are still pending verification.
+// A returned error means the user may not have been removed, and the deadline is retried.
+func (m *Monitor) handleVerificationDeadline(
+	ctx context.Context,
+	logger *logrus.Entry,
+	deadline *models.VerificationDeadline,
+) error {
+	user, err := m.storage.GetUser(ctx, deadline.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		logger.Warnf("user of %v is gone, nothing to do", deadline)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+
+	action := models.TimeoutAction(m.config.TimeoutAction)
+	if chatState, err := m.storage.GetChatState(ctx, user.ChatID); err != nil {
+		logger.Errorf("failed to get chat state, using default timeout action: %v", err)
+	} else {
+		action = chatState.EffectiveSettings(m.config.ChatDefaults()).TimeoutAction
+	}
+
+	status := models.UserStatusKicked
+	if action == models.TimeoutActionBan {
+		status = models.UserStatusBanned
+	}
+
+	chat := &telebot.Chat{ID: user.ChatID}
+	tgUser := &telebot.User{ID: user.TelegramID}
+
+	switch user.Status {
+	case models.UserStatusJustJoined, models.UserStatusJoinRequested:
+		// The user may log in or be accepted after being read, only the status change decides
+		// whether they are removed.
+		updated, err := m.storage.SetPendingUserStatus(ctx, user.ID, status)
+		if err != nil {
+			return fmt.Errorf("updating user to %v: %w", status, err)
+		}
+		if !updated {
+			logger.Infof("user %v was verified before the deadline", user.TelegramID)
+			return nil
 		}
+		m.forgetLoginLinks(ctx, logger, user)
 
-		if err := m.storage.DeleteMessages(ctx, msgs); err != nil {
-			logger.Errorf("failed to delete messages: %v", err)
+		if user.Status == models.UserStatusJoinRequested {
+			logger.Infof("declining join request of user %v by timeout", user.TelegramID)
+			// The request may have been withdrawn, that's not worth retrying.
+			if err := m.bot.DeclineJoinRequest(chat, tgUser); err != nil {
+				logger.Errorf("failed to decline join request of user %v: %v", user, err)
+			}
+		} else {
+			logger.Infof("removing user %v by timeout", user.TelegramID)
 		}
+
+		metrics.TimeoutRemovals.WithLabelValues(string(action)).Inc()
+
+	case status:
+		// Removals cancel deadlines, so an earlier attempt has set the status but failed to remove the user.
+		logger.Infof("retrying removal of user %v by timeout", user.TelegramID)
+
+	default:
+		logger.Debugf("user %v is %v at the deadline, nothing to do", user.TelegramID, user.Status)
+		return nil
 	}
 
-	t := time.NewTicker(m.config.CleanerInterval)
-	defer t.Stop()
+	switch action {
+	case models.TimeoutActionBan:
+		if err := m.bot.Ban(chat, &telebot.ChatMember{User: tgUser}); err != nil {
+			return fmt.Errorf("banning user: %w", err)
+		}
 
-	run()
-	for {
-		select {
-		case <-t.C:
-			run()
-		case <-ctx.Done():
-			return
+	default:
+		// Users who only requested to join are not members, unbanning them would be a no-op anyway.
+		if user.Status != models.UserStatusJoinRequested {
+			if err := m.bot.Unban(chat, tgUser); err != nil {
+				return fmt.Errorf("kicking user: %w", err)
+			}
 		}
 	}
+
+	return nil
+}
+
+// forgetLoginLinks deletes the login links of the removed user,
+// so a login started before the removal can't let them back in.
+func (m *Monitor) forgetLoginLinks(ctx context.Context, logger *logrus.Entry, user *models.User) {
+	if err := m.storage.DeleteUserOAuthStates(ctx, user.ID); err != nil {
+		logger.Errorf("failed to delete login links of user %v: %v", user.TelegramID, err)
+	}
 }
 
 func (m *Monitor) RunUpdateChatAdmins(ctx context.Context) {
@@ -475,7 +923,7 @@ func (m *Monitor) RunUpdateChatAdmins(ctx context.Context) {
 			return
 		}
 
-		me := m.bot.(*telebot.Bot).Me
+		me := tgutil.Me(m.bot)
 
 		for _, chat := range chats {
 			if chat.ChatType == telebot.ChatPrivate {
@@ -500,7 +948,7 @@ func (m *Monitor) RunUpdateChatAdmins(ctx context.Context) {
 			chatLogger.Debugf("chat has %d admins", len(admins))
 			chat.Admins = admins
 
-			if err := m.storage.UpdateChatState(ctx, chat); err != nil {
+			if err := m.storage.UpdateChatMembers(ctx, chat); err != nil {
 				chatLogger.Errorf("failed to update chat state for chat %v: %v", chat, err)
 			}
 		}
@@ -527,7 +975,9 @@ func (m *Monitor) deleteMessageChecked(msg telebot.Editable, logger *logrus.Entr
 		} else {
 			logger.Errorf("failed to delete message %v: %v", msg, err)
 		}
+		return
 	}
+	metrics.DeletedMessages.WithLabelValues("bot").Inc()
 }
 
 func (m *Monitor) checkSenderAdmin(uc *UpdateContext) error {
@@ -545,32 +995,12 @@ func (m *Monitor) checkSenderAdmin(uc *UpdateContext) error {
 }
 
 func isMemberStatus(member *telebot.ChatMember) bool {
-	return member != nil && member.Role == telebot.Member
+	return member != nil && (member.Role == telebot.Member || (member.Role == telebot.Restricted && member.Member))
 }
 
 func isLeftStatus(member *telebot.ChatMember) bool {
-	return member == nil || member.Role == telebot.Left || member.Role == telebot.Kicked
-}
-
-func escapeMarkdownV2(s string) string {
-	return strings.NewReplacer(
-		"_", "\\_",
-		"*", "\\*",
-		"[", "\\[",
-		"]", "\\]",
-		"(", "\\(",
-		")", "\\)",
-		"~", "\\~",
-		"`", "\\`",
-		">", "\\>",
-		"#", "\\#",
-		"+", "\\+",
-		"-", "\\-",
-		"=", "\\=",
-		"|", "\\|",
-		"{", "\\{",
-		"}", "\\}",
-		".", "\\.",
-		"!", "\\!",
-	).Replace(s)
+	return member == nil ||
+		member.Role == telebot.Left ||
+		member.Role == telebot.Kicked ||
+		(member.Role == telebot.Restricted && !member.Member)
 }
@@ -0,0 +1,201 @@
+package monitor
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// raidSummaryUpdateInterval limits how often the raid summary is edited with the new join count.
+const raidSummaryUpdateInterval = 10 * time.Second
+
+// registerJoin counts the join and reports whether the chat is in raid mode,
+// switching into it if the join burst exceeds the threshold. The joins are counted in the storage,
+// so a raid split between the bot replicas is detected and started by one of them.
+func (m *Monitor) registerJoin(uc *UpdateContext, settings models.EffectiveSettings) bool {
+	if m.config.RaidJoinThreshold <= 0 {
+		return false
+	}
+
+	now := time.Now()
+
+	var started, update bool
+	state, err := m.storage.UpdateRaidState(uc, uc.Chat().ID, func(state *models.RaidState) {
+		state.LastJoinAt = now
+
+		if state.Active {
+			state.Joined++
+			update = state.SummaryMessageID != 0 && now.Sub(state.SummaryUpdatedAt) >= raidSummaryUpdateInterval
+			if update {
+				state.SummaryUpdatedAt = now
+			}
+			return
+		}
+
+		state.Joins = slices.DeleteFunc(state.Joins, func(t time.Time) bool {
+			return now.Sub(t) > m.config.RaidJoinWindow
+		})
+		state.Joins = append(state.Joins, now)
+		if len(state.Joins) < m.config.RaidJoinThreshold {
+			return
+		}
+
+		started = true
+		state.Active = true
+		state.Joined = len(state.Joins)
+		state.Joins = nil
+		state.Language = string(uc.Lang())
+		state.Title = uc.Chat().Title
+		state.LoginTimeout = settings.JoinLoginTimeout
+	})
+	if err != nil {
+		uc.L().Errorf("failed to update raid state: %v", err)
+		return false
+	}
+
+	if !started && !update {
+		return state.Active
+	}
+
+	summaryText, summaryMarkup := m.raidSummary(uc, settings)
+	switch {
+	case started:
+		m.startRaid(uc, state, summaryText(state.Joined), summaryMarkup)
+	case update:
+		summary := &telebot.Message{ID: state.SummaryMessageID, Chat: uc.Chat()}
+		if _, err := m.bot.Edit(summary, summaryText(state.Joined), summaryMarkup); err != nil {
+			uc.L().Warnf("failed to update raid summary: %v", err)
+		}
+	}
+	return state.Active
+}
+
+func (m *Monitor) raidSummary(
+	uc *UpdateContext,
+	settings models.EffectiveSettings,
+) (func(joined int) string, *telebot.ReplyMarkup) {
+	lang := uc.Lang()
+	markup := &telebot.ReplyMarkup{}
+
+	if settings.VerificationProvider != models.VerificationProviderCTFTime {
+		return func(joined int) string {
+			return lang.T(i18n.RaidSummaryAdmin, joined, lang.Duration(settings.JoinLoginTimeout))
+		}, markup
+	}
+
+	markup.Inline(markup.Row(markup.URL(lang.T(i18n.LoginButton), m.loginDeepLink(uc.Chat().ID))))
+	return func(joined int) string {
+		return lang.T(i18n.RaidSummary, joined, lang.Duration(settings.JoinLoginTimeout))
+	}, markup
+}
+
+// startRaid posts the summary, revokes the invite link if configured and notifies the admins.
+func (m *Monitor) startRaid(uc *UpdateContext, state *models.RaidState, text string, markup *telebot.ReplyMarkup) {
+	uc.L().Warnf("join burst detected, switching into raid mode")
+	metrics.Raids.Inc()
+
+	summary, err := m.bot.Send(uc.Chat(), text, markup)
+	if err != nil {
+		uc.L().Errorf("failed to send raid summary: %v", err)
+	}
+
+	linkRevoked := false
+	if m.config.RaidRevokeInviteLink {
+		// Exporting a new primary link revokes the old one, the new one is only shared with admins after the raid.
+		if _, err := m.bot.InviteLink(uc.Chat()); err != nil {
+			uc.L().Errorf("failed to revoke invite link: %v", err)
+		} else {
+			linkRevoked = true
+		}
+	}
+
+	if _, err := m.storage.UpdateRaidState(uc, uc.Chat().ID, func(state *models.RaidState) {
+		if summary != nil {
+			state.SummaryMessageID = summary.ID
+		}
+		state.SummaryUpdatedAt = time.Now()
+		state.LinkRevoked = linkRevoked
+	}); err != nil {
+		uc.L().Errorf("failed to save raid summary: %v", err)
+	}
+
+	lang := i18n.Lang(state.Language)
+	notification := lang.T(i18n.RaidStarted, state.Title, lang.Duration(m.config.RaidQuietPeriod))
+	if linkRevoked {
+		notification += "\n" + lang.T(i18n.RaidLinkRevoked)
+	}
+	m.notifyAdmins(uc.ChatState(), notification, uc.L())
+}
+
+// endQuietRaids leaves raid mode in chats without joins for the quiet period
+// and forgets join history older than the window.
+func (m *Monitor) endQuietRaids(ctx context.Context, logger *logrus.Entry) {
+	now := time.Now()
+
+	ended, err := m.storage.EndQuietRaids(ctx, now.Add(-m.config.RaidQuietPeriod), now.Add(-m.config.RaidJoinWindow))
+	if err != nil {
+		logger.Errorf("failed to end quiet raids: %v", err)
+		return
+	}
+
+	for _, state := range ended {
+		chatLogger := logger.WithField("chat_id", state.ChatID)
+		chatLogger.Infof("no joins for %v, leaving raid mode after %d joins", m.config.RaidQuietPeriod, state.Joined)
+
+		// The summary holds the only login button of the raid joiners, so it's cleaned up with the expired messages.
+		if state.SummaryMessageID != 0 {
+			expiresAt := state.LastJoinAt.Add(state.LoginTimeout)
+			if err := m.storage.AddMessage(ctx, &models.Message{
+				ChatID:      state.ChatID,
+				MessageID:   strconv.Itoa(state.SummaryMessageID),
+				MessageType: models.MessageTypeRaidSummary,
+				ExpiresAt:   &expiresAt,
+			}); err != nil {
+				chatLogger.Errorf("failed to add raid summary to db, deleting it: %v", err)
+				m.deleteMessageChecked(&telebot.Message{
+					ID:   state.SummaryMessageID,
+					Chat: &telebot.Chat{ID: state.ChatID},
+				}, chatLogger)
+			}
+		}
+
+		lang := i18n.Lang(state.Language)
+		lines := []string{lang.T(i18n.RaidEnded, state.Title, state.Joined)}
+		if state.LinkRevoked {
+			link, err := m.bot.InviteLink(&telebot.Chat{ID: state.ChatID})
+			if err != nil {
+				chatLogger.Errorf("failed to create invite link: %v", err)
+			} else {
+				lines = append(lines, lang.T(i18n.RaidNewLink, link))
+			}
+		}
+
+		chatState, err := m.storage.GetChatState(ctx, state.ChatID)
+		if err != nil {
+			chatLogger.Errorf("failed to get chat state: %v", err)
+			continue
+		}
+		m.notifyAdmins(chatState, strings.Join(lines, "\n"), chatLogger)
+	}
+}
+
+// notifyAdmins sends the text privately to the admins of the chat,
+// admins who never started the bot can't be reached.
+func (m *Monitor) notifyAdmins(chatState *models.ChatState, text string, logger *logrus.Entry) {
+	for _, admin := range chatState.Admins {
+		if admin.User == nil || admin.User.IsBot {
+			continue
+		}
+		if _, err := m.bot.Send(admin.User, text); err != nil {
+			logger.Debugf("failed to notify admin %v: %v", admin.User.ID, err)
+		}
+	}
+}
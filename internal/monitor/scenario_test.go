@@ -0,0 +1,1121 @@
+package monitor_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/api"
+	"github.com/C4T-BuT-S4D/shpaga/internal/config"
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/C4T-BuT-S4D/shpaga/internal/monitor"
+	"github.com/C4T-BuT-S4D/shpaga/internal/oauthmock"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgtest"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/telebot.v4"
+)
+
+const testChatID = -100123
+
+var (
+	testChat  = &telebot.Chat{ID: testChatID, Type: telebot.ChatSuperGroup, Title: "CTF chat"}
+	testUser  = &telebot.User{ID: 42, FirstName: "Alice", Username: "alice", LanguageCode: "en"}
+	testAdmin = &telebot.User{ID: 7, FirstName: "Admin"}
+)
+
+type harness struct {
+	t *testing.T
+
+	cfg     *config.Config
+	tg      *tgtest.Server
+	oauth   *httptest.Server
+	bot     *telebot.Bot
+	store   *storage.Memory
+	monitor *monitor.Monitor
+	service *api.Service
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	tg := tgtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	bot, err := tg.NewBot()
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+
+	oauth := httptest.NewServer(oauthmock.New("client-id", "client-secret").Handler())
+	t.Cleanup(oauth.Close)
+
+	cfg := &config.Config{
+		TelegramToken:        tgtest.Token,
+		BotHandleTimeout:     5 * time.Second,
+		JoinLoginTimeout:     time.Minute,
+		JoinRequestsEnabled:  true,
+		TimeoutAction:        string(models.TimeoutActionKick),
+		ShowAdminButtons:     true,
+		VerificationProvider: string(models.VerificationProviderCTFTime),
+		Language:             string(i18n.English),
+		CTFTimeClientID:      "client-id",
+		CTFTimeClientSecret:  "client-secret",
+		CTFTimeOAuthURL:      oauth.URL,
+		CTFTimePKCE:          true,
+		CTFTimeRedirectURL:   "http://localhost/oauth_callback",
+		OAuthStateSecret:     "secret",
+		OAuthStateTTL:        15 * time.Minute,
+	}
+
+	store := storage.NewMemory()
+
+	return &harness{
+		t:       t,
+		cfg:     cfg,
+		tg:      tg,
+		oauth:   oauth,
+		bot:     bot,
+		store:   store,
+		monitor: monitor.New(cfg, store, bot),
+		service: api.NewService(cfg, store, bot),
+	}
+}
+
+func (h *harness) handle(update telebot.Update) {
+	h.t.Helper()
+
+	update = h.tg.PushUpdate(update)
+	if err := h.monitor.HandleAnyUpdate(h.bot.NewContext(update)); err != nil {
+		h.t.Fatalf("handling update: %v", err)
+	}
+}
+
+func (h *harness) user() *models.User {
+	h.t.Helper()
+
+	user, err := h.store.GetChatUser(context.Background(), testChatID, testUser.ID)
+	if err != nil {
+		h.t.Fatalf("getting user: %v", err)
+	}
+	return user
+}
+
+func (h *harness) setAdmins(admins ...*telebot.User) {
+	h.t.Helper()
+
+	state, err := h.store.GetOrCreateChatState(context.Background(), testChatID, testChat.Type)
+	if err != nil {
+		h.t.Fatalf("getting chat state: %v", err)
+	}
+	state.Admins = nil
+	for _, admin := range admins {
+		state.Admins = append(state.Admins, telebot.ChatMember{User: admin, Role: telebot.Administrator})
+	}
+	if err := h.store.UpdateChatMembers(context.Background(), state); err != nil {
+		h.t.Fatalf("updating chat admins: %v", err)
+	}
+}
+
+// login logs in on the mock provider as the CTFTime user and returns the callback url.
+func (h *harness) login(loginURL string, ctftimeUserID int64) string {
+	h.t.Helper()
+
+	parsed, err := url.Parse(loginURL)
+	if err != nil {
+		h.t.Fatalf("parsing login url: %v", err)
+	}
+	form := parsed.Query()
+	form.Set("user_id", strconv.FormatInt(ctftimeUserID, 10))
+	form.Set("name", "player")
+	form.Set("country", "RU")
+	form.Set("team_id", "7")
+	form.Set("team_name", "C4T BuT S4D")
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.PostForm(h.oauth.URL+"/authorize", form)
+	if err != nil {
+		h.t.Fatalf("authorizing on the provider: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		h.t.Fatalf("provider returned %d, want a redirect", resp.StatusCode)
+	}
+	return resp.Header.Get("Location")
+}
+
+// callback runs the OAuth callback handler and returns the response code.
+func (h *harness) callback(callbackURL string) int {
+	h.t.Helper()
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, callbackURL, nil), rec)
+	if err := h.service.HandleOAuthCallback()(c); err != nil {
+		h.t.Fatalf("handling callback: %v", err)
+	}
+	return rec.Code
+}
+
+// lastCall returns the last call of the method, failing the test if there is none.
+func (h *harness) lastCall(method string) tgtest.Call {
+	h.t.Helper()
+
+	calls := h.tg.Calls(method)
+	if len(calls) == 0 {
+		h.t.Fatalf("expected a %s call, got calls %v", method, h.tg.Calls())
+	}
+	return calls[len(calls)-1]
+}
+
+func joinUpdate(user *telebot.User) telebot.Update {
+	return telebot.Update{
+		ChatMember: &telebot.ChatMemberUpdate{
+			Chat:          testChat,
+			Sender:        user,
+			Unixtime:      time.Now().Unix(),
+			OldChatMember: &telebot.ChatMember{User: user, Role: telebot.Left},
+			NewChatMember: &telebot.ChatMember{User: user, Role: telebot.Member},
+		},
+	}
+}
+
+func chatMessageUpdate(user *telebot.User, id int, text string) telebot.Update {
+	return telebot.Update{
+		Message: &telebot.Message{
+			ID:       id,
+			Chat:     testChat,
+			Sender:   user,
+			Unixtime: time.Now().Unix(),
+			Text:     text,
+		},
+	}
+}
+
+func privateMessageUpdate(user *telebot.User, text string) telebot.Update {
+	return telebot.Update{
+		Message: &telebot.Message{
+			ID:       1,
+			Chat:     &telebot.Chat{ID: user.ID, Type: telebot.ChatPrivate},
+			Sender:   user,
+			Unixtime: time.Now().Unix(),
+			Text:     text,
+		},
+	}
+}
+
+func buttonURLs(t *testing.T, call tgtest.Call) []string {
+	t.Helper()
+
+	var markup telebot.ReplyMarkup
+	if err := call.Decode("reply_markup", &markup); err != nil {
+		t.Fatalf("decoding markup: %v", err)
+	}
+
+	var urls []string
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if button.URL != "" {
+				urls = append(urls, button.URL)
+			}
+		}
+	}
+	return urls
+}
+
+func TestScenarioJoinLoginUnlock(t *testing.T) {
+	h := newHarness(t)
+
+	h.handle(joinUpdate(testUser))
+
+	restrict := h.lastCall("restrictChatMember")
+	if restrict.Param("user_id") != "42" {
+		t.Fatalf("restricted user %s, want 42", restrict.Param("user_id"))
+	}
+
+	greeting := h.lastCall("sendMessage")
+	if greeting.Param("chat_id") != strconv.Itoa(testChatID) {
+		t.Fatalf("greeting sent to %s, want the chat", greeting.Param("chat_id"))
+	}
+	deepLink := "https://t.me/" + tgtest.BotUser.Username + "?start=" + strconv.Itoa(testChatID)
+	if urls := buttonURLs(t, greeting); len(urls) != 1 || urls[0] != deepLink {
+		t.Fatalf("greeting buttons %v, want %s", urls, deepLink)
+	}
+
+	user := h.user()
+	if user.Status != models.UserStatusJustJoined || !user.Restricted {
+		t.Fatalf("user after join is %s, restricted=%v", user.Status, user.Restricted)
+	}
+
+	// Messages of unverified users are deleted.
+	h.tg.Reset()
+	h.handle(chatMessageUpdate(testUser, 100, "hello"))
+	if deleted := h.lastCall("deleteMessage"); deleted.Param("message_id") != "100" {
+		t.Fatalf("deleted message %s, want 100", deleted.Param("message_id"))
+	}
+
+	h.tg.Reset()
+	h.handle(privateMessageUpdate(testUser, "/start "+strconv.Itoa(testChatID)))
+
+	login := h.lastCall("sendMessage")
+	if login.Param("chat_id") != "42" {
+		t.Fatalf("login link sent to %s, want the user", login.Param("chat_id"))
+	}
+	urls := buttonURLs(t, login)
+	if len(urls) != 1 {
+		t.Fatalf("login buttons %v, want one", urls)
+	}
+	loginURL, err := url.Parse(urls[0])
+	if err != nil {
+		t.Fatalf("parsing login url: %v", err)
+	}
+	if want := h.oauth.URL + "/authorize"; !strings.HasPrefix(urls[0], want+"?") {
+		t.Fatalf("login url %s, want %s", urls[0], want)
+	}
+	if loginURL.Query().Get("code_challenge") == "" {
+		t.Fatalf("login url %s has no code challenge", urls[0])
+	}
+
+	if deleted := h.lastCall("deleteMessage"); deleted.Param("message_id") != strconv.Itoa(greeting.MessageID) ||
+		deleted.Param("chat_id") != strconv.Itoa(testChatID) {
+		t.Fatalf("deleted %+v, want the greeting", deleted)
+	}
+
+	// The user logs in on the provider and gets redirected to the callback.
+	callbackURL := h.login(urls[0], 1337)
+
+	h.tg.Reset()
+	if code := h.callback(callbackURL); code != http.StatusOK {
+		t.Fatalf("callback returned %d", code)
+	}
+
+	var rights telebot.Rights
+	if err := h.lastCall("restrictChatMember").Decode("permissions", &rights); err != nil {
+		t.Fatalf("decoding permissions: %v", err)
+	}
+	if !rights.CanSendMessages {
+		t.Fatalf("restrictions were not lifted: %+v", rights)
+	}
+
+	if loggedIn := h.lastCall("sendMessage"); loggedIn.Param("chat_id") != "42" ||
+		loggedIn.Param("text") != i18n.English.T(i18n.LoggedIn) {
+		t.Fatalf("unexpected logged in message %+v", loggedIn)
+	}
+
+	user = h.user()
+	if user.Status != models.UserStatusActive || user.Restricted || user.CTFTimeUserID != 1337 {
+		t.Fatalf("user after login is %s, restricted=%v, ctftime=%d", user.Status, user.Restricted, user.CTFTimeUserID)
+	}
+
+	// The callback can't be replayed.
+	h.tg.Reset()
+	if code := h.callback(callbackURL); code != http.StatusBadRequest {
+		t.Fatalf("replayed callback returned %d, want 400", code)
+	}
+	if calls := h.tg.Calls(); len(calls) != 0 {
+		t.Fatalf("unexpected calls on replayed callback: %v", calls)
+	}
+
+	// Verified users can talk.
+	h.tg.Reset()
+	h.handle(chatMessageUpdate(testUser, 101, "hi again"))
+	if calls := h.tg.Calls("deleteMessage"); len(calls) != 0 {
+		t.Fatalf("message of verified user was deleted: %v", calls)
+	}
+
+	// Admins can look up the CTFTime profile.
+	h.setAdmins(testAdmin)
+	h.handle(chatMessageUpdate(testAdmin, 102, "/whois @alice"))
+	whois := h.lastCall("sendMessage").Param("text")
+	for _, want := range []string{
+		"Telegram: @alice (42)\n",
+		"Status: active",
+		"CTFTime: player (https://ctftime.org/user/1337)",
+		"Country: RU",
+		"Teams: C4T BuT S4D",
+	} {
+		if !strings.Contains(whois, want) {
+			t.Fatalf("whois %q doesn't contain %q", whois, want)
+		}
+	}
+}
+
+func TestScenarioLoginAfterRemoval(t *testing.T) {
+	h := newHarness(t)
+	h.setAdmins(testAdmin)
+
+	h.handle(joinUpdate(testUser))
+	h.handle(privateMessageUpdate(testUser, "/start "+strconv.Itoa(testChatID)))
+	loginURL := buttonURLs(t, h.lastCall("sendMessage"))[0]
+
+	// The user is removed while the login link is still valid.
+	if err := h.store.SetUserStatus(context.Background(), h.user().ID, models.UserStatusKicked); err != nil {
+		t.Fatalf("setting user status: %v", err)
+	}
+	if code := h.callback(h.login(loginURL, 1337)); code != http.StatusBadRequest {
+		t.Fatalf("callback returned %d, want 400", code)
+	}
+	if user := h.user(); user.Status != models.UserStatusKicked || user.CTFTimeUserID != 0 {
+		t.Fatalf("removed user was authorized: %+v", user)
+	}
+
+	// Bans delete the outstanding login links.
+	h.handle(joinUpdate(testUser))
+	h.handle(privateMessageUpdate(testUser, "/start "+strconv.Itoa(testChatID)))
+	loginURL = buttonURLs(t, h.lastCall("sendMessage"))[0]
+	h.handle(chatMessageUpdate(testAdmin, 1, "/ban 42"))
+
+	if code := h.callback(h.login(loginURL, 1337)); code != http.StatusBadRequest {
+		t.Fatalf("callback returned %d, want 400", code)
+	}
+	if user := h.user(); user.Status != models.UserStatusBanned {
+		t.Fatalf("banned user is %s", user.Status)
+	}
+}
+
+func TestScenarioJoinTimeoutKick(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.JoinLoginTimeout = time.Millisecond
+
+	h.handle(joinUpdate(testUser))
+	greeting := h.lastCall("sendMessage")
+
+	time.Sleep(10 * time.Millisecond)
+
+	h.tg.Reset()
+	h.monitor.Clean(context.Background())
+
+	kick := h.lastCall("unbanChatMember")
+	if kick.Param("chat_id") != strconv.Itoa(testChatID) || kick.Param("user_id") != "42" {
+		t.Fatalf("unexpected kick %+v", kick)
+	}
+
+	deleted := h.lastCall("deleteMessage")
+	if deleted.Param("message_id") != strconv.Itoa(greeting.MessageID) {
+		t.Fatalf("deleted message %s, want the greeting %d", deleted.Param("message_id"), greeting.MessageID)
+	}
+
+	if user := h.user(); user.Status != models.UserStatusKicked {
+		t.Fatalf("user after timeout is %s, want kicked", user.Status)
+	}
+
+	// The greeting is cleaned up only once.
+	h.tg.Reset()
+	h.monitor.Clean(context.Background())
+	if calls := h.tg.Calls(); len(calls) != 0 {
+		t.Fatalf("unexpected calls on the second clean: %v", calls)
+	}
+}
+
+func TestScenarioJoinTimeoutRetry(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.JoinLoginTimeout = time.Millisecond
+
+	h.handle(joinUpdate(testUser))
+	time.Sleep(10 * time.Millisecond)
+
+	// The kick fails, the deadline is kept for a retry.
+	h.tg.Fail("unbanChatMember", http.StatusInternalServerError, 0)
+	h.monitor.Clean(context.Background())
+
+	ctx := context.Background()
+	deadlines, err := h.store.ClaimDueVerificationDeadlines(ctx, time.Now().Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatalf("claiming deadlines: %v", err)
+	}
+	if len(deadlines) != 1 || deadlines[0].UserID != h.user().ID {
+		t.Fatalf("unexpected deadlines after a failed kick: %v", deadlines)
+	}
+	if err := h.store.ReleaseVerificationDeadline(ctx, deadlines[0], time.Now()); err != nil {
+		t.Fatalf("releasing deadline: %v", err)
+	}
+
+	h.tg.Reset()
+	h.monitor.Clean(ctx)
+
+	if kick := h.lastCall("unbanChatMember"); kick.Param("user_id") != "42" {
+		t.Fatalf("unexpected kick %+v", kick)
+	}
+	if user := h.user(); user.Status != models.UserStatusKicked {
+		t.Fatalf("user after timeout is %s, want kicked", user.Status)
+	}
+	if deadlines, _ := h.store.ClaimDueVerificationDeadlines(ctx, time.Now().Add(time.Hour), time.Minute); len(deadlines) != 0 {
+		t.Fatalf("deadline was kept after the kick: %v", deadlines)
+	}
+}
+
+func TestScenarioJoinTimeoutAfterVerification(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.JoinLoginTimeout = time.Millisecond
+
+	h.handle(joinUpdate(testUser))
+
+	// The user is verified after the deadline is due, but before it's processed.
+	time.Sleep(10 * time.Millisecond)
+	if err := h.store.SetUserStatus(context.Background(), h.user().ID, models.UserStatusActive); err != nil {
+		t.Fatalf("setting user status: %v", err)
+	}
+
+	h.tg.Reset()
+	h.monitor.Clean(context.Background())
+
+	if calls := h.tg.Calls("unbanChatMember"); len(calls) != 0 {
+		t.Fatalf("verified user was kicked: %v", calls)
+	}
+	if user := h.user(); user.Status != models.UserStatusActive {
+		t.Fatalf("user after the deadline is %s, want active", user.Status)
+	}
+}
+
+func TestScenarioRaid(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.RaidJoinThreshold = 3
+	h.cfg.RaidJoinWindow = time.Minute
+	h.cfg.RaidQuietPeriod = 50 * time.Millisecond
+	h.cfg.RaidRevokeInviteLink = true
+
+	h.setAdmins(testAdmin)
+
+	joiners := make([]*telebot.User, 5)
+	for i := range joiners {
+		joiners[i] = &telebot.User{ID: int64(100 + i), FirstName: "Bot" + strconv.Itoa(i)}
+	}
+
+	// The first joins are greeted as usual.
+	for _, user := range joiners[:2] {
+		h.handle(joinUpdate(user))
+	}
+	if calls := h.tg.Calls("sendMessage"); len(calls) != 2 {
+		t.Fatalf("got %d greetings, want 2", len(calls))
+	}
+
+	h.tg.Reset()
+	h.handle(joinUpdate(joiners[2]))
+
+	sent := h.tg.Calls("sendMessage")
+	if len(sent) != 2 {
+		t.Fatalf("got messages %v, want the summary and the admin notification", sent)
+	}
+	summary := sent[0]
+	if summary.Param("chat_id") != strconv.Itoa(testChatID) || !strings.Contains(summary.Param("text"), "3 accounts") {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if urls := buttonURLs(t, summary); len(urls) != 1 {
+		t.Fatalf("summary buttons %v, want the login button", urls)
+	}
+	if sent[1].Param("chat_id") != "7" {
+		t.Fatalf("notification sent to %s, want the admin", sent[1].Param("chat_id"))
+	}
+	if calls := h.tg.Calls("exportChatInviteLink"); len(calls) != 1 {
+		t.Fatalf("invite link was not revoked: %v", h.tg.Calls())
+	}
+
+	// Joins during the raid are restricted without greetings.
+	h.tg.Reset()
+	for _, user := range joiners[3:] {
+		h.handle(joinUpdate(user))
+	}
+	if calls := h.tg.Calls("sendMessage"); len(calls) != 0 {
+		t.Fatalf("unexpected messages during the raid: %v", calls)
+	}
+	if calls := h.tg.Calls("restrictChatMember"); len(calls) != 2 {
+		t.Fatalf("got %d restrictions, want 2", len(calls))
+	}
+
+	// Raid mode is turned off after the quiet period.
+	time.Sleep(100 * time.Millisecond)
+	h.tg.Reset()
+	h.monitor.Clean(context.Background())
+
+	// The summary is kept for the login timeout after the last join.
+	if calls := h.tg.Calls("deleteMessage"); len(calls) != 0 {
+		t.Fatalf("summary was deleted at the end of the raid: %v", calls)
+	}
+	expired, err := h.store.GetExpiredMessages(context.Background(), time.Now().Add(2*time.Minute), time.Time{})
+	if err != nil {
+		t.Fatalf("getting expired messages: %v", err)
+	}
+	if !slices.ContainsFunc(expired, func(msg *models.Message) bool {
+		return msg.MessageType == models.MessageTypeRaidSummary && msg.MessageID == strconv.Itoa(summary.MessageID)
+	}) {
+		t.Fatalf("expiring messages %v, want the summary", expired)
+	}
+	ended := h.lastCall("sendMessage")
+	if ended.Param("chat_id") != "7" || !strings.Contains(ended.Param("text"), "5 accounts") ||
+		!strings.Contains(ended.Param("text"), "https://t.me/+invite") {
+		t.Fatalf("unexpected notification %+v", ended)
+	}
+
+	h.tg.Reset()
+	h.handle(joinUpdate(testUser))
+	if greeting := h.lastCall("sendMessage"); greeting.Param("chat_id") != strconv.Itoa(testChatID) {
+		t.Fatalf("unexpected greeting %+v", greeting)
+	}
+}
+
+func TestScenarioRaidAcrossReplicas(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.RaidJoinThreshold = 2
+	h.cfg.RaidJoinWindow = time.Minute
+	h.setAdmins(testAdmin)
+
+	replica := monitor.New(h.cfg, h.store, h.bot)
+	handleOnReplica := func(update telebot.Update) {
+		t.Helper()
+		update = h.tg.PushUpdate(update)
+		if err := replica.HandleAnyUpdate(h.bot.NewContext(update)); err != nil {
+			t.Fatalf("handling update: %v", err)
+		}
+	}
+
+	// Joins seen by different replicas are counted together.
+	h.handle(joinUpdate(&telebot.User{ID: 100, FirstName: "Bot0"}))
+	h.tg.Reset()
+	handleOnReplica(joinUpdate(&telebot.User{ID: 101, FirstName: "Bot1"}))
+	if sent := h.tg.Calls("sendMessage"); len(sent) != 2 || !strings.Contains(sent[0].Param("text"), "2 accounts") {
+		t.Fatalf("got messages %v, want the summary and the admin notification", sent)
+	}
+
+	h.tg.Reset()
+	h.handle(joinUpdate(&telebot.User{ID: 102, FirstName: "Bot2"}))
+	if calls := h.tg.Calls("sendMessage"); len(calls) != 0 {
+		t.Fatalf("unexpected messages during the raid: %v", calls)
+	}
+}
+
+func TestScenarioRaidAdminVerification(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.VerificationProvider = string(models.VerificationProviderAdmin)
+	h.cfg.RaidJoinThreshold = 1
+	h.cfg.RaidJoinWindow = time.Minute
+	h.setAdmins(testAdmin)
+
+	h.handle(joinUpdate(testUser))
+	if text := h.tg.Calls("sendMessage")[0].Param("text"); !strings.Contains(text, "/accept") {
+		t.Fatalf("summary %q doesn't tell admins how to accept", text)
+	}
+
+	h.tg.Reset()
+	h.handle(chatMessageUpdate(testAdmin, 10, "/accept @alice"))
+
+	if user := h.user(); user.Status != models.UserStatusActive || user.Restricted {
+		t.Fatalf("user after accept is %s, restricted=%v", user.Status, user.Restricted)
+	}
+	if text := h.lastCall("sendMessage").Param("text"); text != "✅ @alice (42) was accepted by Admin." {
+		t.Fatalf("unexpected confirmation %q", text)
+	}
+
+	h.tg.Reset()
+	h.handle(chatMessageUpdate(testAdmin, 11, "/accept @alice"))
+	if text := h.lastCall("sendMessage").Param("text"); text != "@alice (42) is not waiting for verification." {
+		t.Fatalf("unexpected reply %q", text)
+	}
+}
+
+func TestScenarioModeration(t *testing.T) {
+	h := newHarness(t)
+	h.setAdmins(testAdmin)
+
+	spammer := &telebot.User{ID: 43, FirstName: "Spammer", Username: "Spammer"}
+	h.handle(chatMessageUpdate(testUser, 1, "hello"))
+	h.handle(chatMessageUpdate(spammer, 2, "buy now"))
+
+	// Non-admins' commands are ignored.
+	h.tg.Reset()
+	h.handle(chatMessageUpdate(testUser, 3, "/ban @spammer"))
+	if calls := h.tg.Calls(); len(calls) != 0 {
+		t.Fatalf("unexpected calls for a non-admin command: %v", calls)
+	}
+
+	// Ban by reply.
+	reply := chatMessageUpdate(testAdmin, 4, "/ban")
+	reply.Message.ReplyTo = &telebot.Message{ID: 2, Chat: testChat, Sender: spammer, Text: "buy now"}
+	h.handle(reply)
+
+	if ban := h.lastCall("kickChatMember"); ban.Param("user_id") != "43" {
+		t.Fatalf("banned %s, want the spammer", ban.Param("user_id"))
+	}
+	if deleted := h.lastCall("deleteMessage"); deleted.Param("message_id") != "4" {
+		t.Fatalf("deleted message %s, want the command", deleted.Param("message_id"))
+	}
+	confirmation := h.lastCall("sendMessage").Param("text")
+	if !strings.Contains(confirmation, "Spammer (43)") || !strings.Contains(confirmation, "Admin") {
+		t.Fatalf("unexpected confirmation %q", confirmation)
+	}
+	user, err := h.store.GetChatUser(context.Background(), testChatID, spammer.ID)
+	if err != nil {
+		t.Fatalf("getting user: %v", err)
+	}
+	if user.Status != models.UserStatusBanned {
+		t.Fatalf("status %v, want banned", user.Status)
+	}
+
+	// Unban by @username, the user never logged in and has to verify again.
+	h.handle(chatMessageUpdate(testAdmin, 5, "/unban @spammer"))
+	if unban := h.lastCall("unbanChatMember"); unban.Param("user_id") != "43" || unban.Param("only_if_banned") != "true" {
+		t.Fatalf("unexpected unban %+v", unban)
+	}
+	if user, _ = h.store.GetChatUser(context.Background(), testChatID, spammer.ID); user.Status != models.UserStatusKicked {
+		t.Fatalf("status %v, want kicked", user.Status)
+	}
+
+	// Mute by id.
+	h.tg.Reset()
+	h.handle(chatMessageUpdate(testAdmin, 6, "/mute 42 2h"))
+	mute := h.lastCall("restrictChatMember")
+	until, _ := strconv.ParseInt(mute.Param("until_date"), 10, 64)
+	if mute.Param("user_id") != "42" || time.Until(time.Unix(until, 0)).Round(time.Minute) != 2*time.Hour {
+		t.Fatalf("unexpected restriction %+v", mute)
+	}
+	if text := h.lastCall("sendMessage").Param("text"); !strings.Contains(text, "2 hours") {
+		t.Fatalf("unexpected confirmation %q", text)
+	}
+
+	// Invalid usages are answered without acting.
+	for _, command := range []string{"/mute 42", "/kick", "/kick @nobody", "/kick 7"} {
+		h.tg.Reset()
+		h.handle(chatMessageUpdate(testAdmin, 7, command))
+		if calls := h.tg.Calls("deleteMessage"); len(calls) != 0 {
+			t.Fatalf("%s: command was deleted", command)
+		}
+		if reply := h.lastCall("sendMessage"); reply.Param("reply_to_message_id") != "7" {
+			t.Fatalf("%s: unexpected reply %+v", command, reply)
+		}
+	}
+}
+
+func TestScenarioModerationUnverified(t *testing.T) {
+	h := newHarness(t)
+	h.setAdmins(testAdmin)
+
+	// A warning issued before the user joins doesn't let them skip the verification.
+	h.handle(chatMessageUpdate(testAdmin, 1, "/warn 42 spam elsewhere"))
+	if user := h.user(); user.Status != models.UserStatusKicked {
+		t.Fatalf("status %v after a warning by id, want kicked", user.Status)
+	}
+
+	h.handle(joinUpdate(testUser))
+	if user := h.user(); user.Status != models.UserStatusJustJoined || !user.Restricted {
+		t.Fatalf("user after join is %s, restricted=%v", user.Status, user.Restricted)
+	}
+
+	// Muting would lift the verification restriction when the mute expires.
+	h.tg.Reset()
+	h.handle(chatMessageUpdate(testAdmin, 2, "/mute 42 1h"))
+	if calls := h.tg.Calls("restrictChatMember"); len(calls) != 0 {
+		t.Fatalf("muted a user pending verification: %v", calls)
+	}
+	if text := h.lastCall("sendMessage").Param("text"); !strings.Contains(text, "hasn't passed the verification") {
+		t.Fatalf("unexpected reply %q", text)
+	}
+}
+
+func TestScenarioKickVerified(t *testing.T) {
+	h := newHarness(t)
+	h.setAdmins(testAdmin)
+
+	ctx := context.Background()
+	user, err := h.store.GetOrCreateUser(ctx, testChatID, testUser.ID, models.UserStatusJustJoined)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := h.store.OnUserAuthorized(ctx, user.ID, models.CTFTimeProfile{UserID: 1337}); err != nil {
+		t.Fatalf("authorizing user: %v", err)
+	}
+
+	// Kicked members keep their verification, like unbanned ones.
+	h.handle(chatMessageUpdate(testAdmin, 1, "/kick 42"))
+	if user := h.user(); user.Status != models.UserStatusActive {
+		t.Fatalf("status %v after a kick, want active", user.Status)
+	}
+
+	h.tg.Reset()
+	h.handle(joinUpdate(testUser))
+	if calls := h.tg.Calls("restrictChatMember", "sendMessage"); len(calls) != 0 {
+		t.Fatalf("verified user was asked to verify again: %v", calls)
+	}
+}
+
+func TestScenarioWarnings(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.WarnMuteThreshold = 2
+	h.cfg.WarnBanThreshold = 3
+	h.cfg.WarnMuteDuration = time.Hour
+	h.cfg.WarnExpiry = 24 * time.Hour
+	h.setAdmins(testAdmin)
+
+	h.handle(chatMessageUpdate(testUser, 1, "hello"))
+
+	h.handle(chatMessageUpdate(testAdmin, 2, "/warn @alice flood"))
+	if text := h.lastCall("sendMessage").Param("text"); !strings.Contains(text, "active warnings: 1") ||
+		!strings.Contains(text, "flood") {
+		t.Fatalf("unexpected confirmation %q", text)
+	}
+	if calls := h.tg.Calls("restrictChatMember"); len(calls) != 0 {
+		t.Fatalf("muted after the first warning: %v", calls)
+	}
+
+	h.handle(chatMessageUpdate(testAdmin, 3, "/warn 42"))
+	if text := h.lastCall("sendMessage").Param("text"); !strings.Contains(text, "Muted for 1 hour after 2 warnings") {
+		t.Fatalf("unexpected confirmation %q", text)
+	}
+	if mute := h.lastCall("restrictChatMember"); mute.Param("user_id") != "42" {
+		t.Fatalf("unexpected restriction %+v", mute)
+	}
+
+	h.handle(chatMessageUpdate(testAdmin, 4, "/warns @alice"))
+	if text := h.lastCall("sendMessage").Param("text"); !strings.Contains(text, "Active warnings of @alice (42): 2") ||
+		!strings.Contains(text, "1. ") || !strings.Contains(text, "2. ") {
+		t.Fatalf("unexpected list %q", text)
+	}
+
+	h.handle(chatMessageUpdate(testAdmin, 5, "/unwarn @alice"))
+	if text := h.lastCall("sendMessage").Param("text"); !strings.Contains(text, "active warnings: 1") {
+		t.Fatalf("unexpected confirmation %q", text)
+	}
+
+	h.handle(chatMessageUpdate(testAdmin, 6, "/warn @alice spam"))
+	h.handle(chatMessageUpdate(testAdmin, 7, "/warn @alice spam"))
+	if text := h.lastCall("sendMessage").Param("text"); !strings.Contains(text, "Banned after 3 warnings") {
+		t.Fatalf("unexpected confirmation %q", text)
+	}
+	if ban := h.lastCall("kickChatMember"); ban.Param("user_id") != "42" {
+		t.Fatalf("unexpected ban %+v", ban)
+	}
+	if user := h.user(); user.Status != models.UserStatusBanned {
+		t.Fatalf("status %v, want banned", user.Status)
+	}
+
+	// Warnings expire.
+	warnings, err := h.store.GetActiveWarnings(context.Background(), h.user().ID, time.Now().Add(25*time.Hour))
+	if err != nil {
+		t.Fatalf("getting warnings: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("got %d warnings after the expiry, want none", len(warnings))
+	}
+}
+
+func TestScenarioFederation(t *testing.T) {
+	h := newHarness(t)
+	h.setAdmins(testAdmin)
+
+	otherChat := &telebot.Chat{ID: -100456, Type: telebot.ChatSuperGroup, Title: "Other chat"}
+	otherState, err := h.store.GetOrCreateChatState(context.Background(), otherChat.ID, otherChat.Type)
+	if err != nil {
+		t.Fatalf("getting chat state: %v", err)
+	}
+	otherState.Admins = []telebot.ChatMember{{User: testAdmin, Role: telebot.Administrator}}
+	if err := h.store.UpdateChatMembers(context.Background(), otherState); err != nil {
+		t.Fatalf("updating chat admins: %v", err)
+	}
+	inOther := func(update telebot.Update) telebot.Update {
+		if update.Message != nil {
+			update.Message.Chat = otherChat
+		}
+		if update.ChatMember != nil {
+			update.ChatMember.Chat = otherChat
+		}
+		return update
+	}
+
+	h.handle(chatMessageUpdate(testAdmin, 1, "/fedcreate CTF groups"))
+	state, err := h.store.GetChatState(context.Background(), testChatID)
+	if err != nil {
+		t.Fatalf("getting chat state: %v", err)
+	}
+	if state.FederationID == nil || !strings.Contains(h.lastCall("sendMessage").Param("text"), *state.FederationID) {
+		t.Fatalf("federation was not created: %+v", state)
+	}
+	federationID := *state.FederationID
+
+	// Only the owner can add chats.
+	other := &telebot.User{ID: 8, FirstName: "Other admin"}
+	otherState.Admins = append(otherState.Admins, telebot.ChatMember{User: other, Role: telebot.Administrator})
+	if err := h.store.UpdateChatMembers(context.Background(), otherState); err != nil {
+		t.Fatalf("updating chat admins: %v", err)
+	}
+	h.handle(inOther(chatMessageUpdate(other, 1, "/fedjoin "+federationID)))
+	if text := h.lastCall("sendMessage").Param("text"); !strings.Contains(text, "Only the owner") {
+		t.Fatalf("unexpected reply %q", text)
+	}
+
+	h.handle(inOther(chatMessageUpdate(testAdmin, 2, "/fedjoin "+federationID)))
+	if state, _ := h.store.GetChatState(context.Background(), otherChat.ID); state.FederationID == nil ||
+		*state.FederationID != federationID {
+		t.Fatalf("chat did not join the federation: %+v", state)
+	}
+
+	// A ban in one chat is applied to the others in the background, failures are retried.
+	h.tg.Reset()
+	h.handle(chatMessageUpdate(testAdmin, 3, "/ban 43"))
+	if bans := h.tg.Calls("kickChatMember"); len(bans) != 1 || bans[0].Param("chat_id") != strconv.Itoa(testChatID) {
+		t.Fatalf("unexpected bans %v", bans)
+	}
+
+	h.tg.Fail("kickChatMember", http.StatusInternalServerError, 0)
+	h.monitor.Clean(context.Background())
+	actions, err := h.store.ClaimDueFederationActions(context.Background(), time.Now().Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatalf("claiming federation actions: %v", err)
+	}
+	if len(actions) != 1 || actions[0].ChatID != otherChat.ID || !actions[0].Ban || actions[0].Attempts != 1 {
+		t.Fatalf("failed ban was not retried: %v", actions)
+	}
+	if err := h.store.RetryFederationAction(context.Background(), actions[0], time.Now()); err != nil {
+		t.Fatalf("retrying federation action: %v", err)
+	}
+
+	h.tg.Reset()
+	h.monitor.Clean(context.Background())
+	if bans := h.tg.Calls("kickChatMember"); len(bans) != 1 || bans[0].Param("chat_id") != strconv.FormatInt(otherChat.ID, 10) {
+		t.Fatalf("unexpected bans %v", bans)
+	}
+	if user, err := h.store.GetChatUser(context.Background(), otherChat.ID, 43); err != nil || user.Status != models.UserStatusBanned {
+		t.Fatalf("unexpected user %+v: %v", user, err)
+	}
+
+	// Banned users joining other chats are removed without greetings, the others are greeted.
+	h.tg.Reset()
+	h.handle(inOther(joinUpdate(&telebot.User{ID: 43, FirstName: "Spammer"})))
+	if calls := h.tg.Calls("sendMessage"); len(calls) != 0 {
+		t.Fatalf("banned user was greeted: %v", calls)
+	}
+	if ban := h.lastCall("kickChatMember"); ban.Param("user_id") != "43" {
+		t.Fatalf("unexpected ban %+v", ban)
+	}
+
+	h.handle(inOther(joinUpdate(testUser)))
+	if greeting := h.lastCall("sendMessage"); greeting.Param("chat_id") != strconv.FormatInt(otherChat.ID, 10) {
+		t.Fatalf("unexpected greeting %+v", greeting)
+	}
+
+	// Admins of other chats only unban locally.
+	h.tg.Reset()
+	h.handle(inOther(chatMessageUpdate(other, 3, "/unban 43")))
+	if text := h.tg.Calls("sendMessage")[0].Param("text"); !strings.Contains(text, "still banned in the other chats") {
+		t.Fatalf("unexpected reply %q", text)
+	}
+	h.monitor.Clean(context.Background())
+	if unbans := h.tg.Calls("unbanChatMember"); len(unbans) != 1 {
+		t.Fatalf("unexpected unbans %v", unbans)
+	}
+	if _, err := h.store.GetFederationBan(context.Background(), federationID, 43); err != nil {
+		t.Fatalf("federation ban was removed: %v", err)
+	}
+
+	// The federation owner lifts bans of any chat.
+	h.tg.Reset()
+	h.handle(inOther(chatMessageUpdate(testAdmin, 4, "/unban 43")))
+	h.monitor.Clean(context.Background())
+	if unbans := h.tg.Calls("unbanChatMember"); len(unbans) != 2 {
+		t.Fatalf("unexpected unbans %v", unbans)
+	}
+	if _, err := h.store.GetFederationBan(context.Background(), federationID, 43); err == nil {
+		t.Fatal("federation ban was not removed")
+	}
+
+	h.handle(inOther(chatMessageUpdate(testAdmin, 5, "/fedleave")))
+	if state, _ := h.store.GetChatState(context.Background(), otherChat.ID); state.FederationID != nil {
+		t.Fatalf("chat did not leave the federation: %+v", state)
+	}
+}
+
+func TestScenarioTrustedVerification(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.TrustVerifications = true
+
+	ctx := context.Background()
+	verified, err := h.store.GetOrCreateUser(ctx, -100456, testUser.ID, models.UserStatusJustJoined)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := h.store.OnUserAuthorized(ctx, verified.ID, models.CTFTimeProfile{UserID: 1001}); err != nil {
+		t.Fatalf("authorizing user: %v", err)
+	}
+
+	h.handle(joinUpdate(testUser))
+
+	if text := h.lastCall("sendMessage").Param("text"); text != "✅ Alice is verified via CTFTime as https://ctftime.org/user/1001" {
+		t.Fatalf("unexpected note %q", text)
+	}
+	if calls := h.tg.Calls("restrictChatMember"); len(calls) != 0 {
+		t.Fatalf("trusted user was restricted: %v", calls)
+	}
+	if user := h.user(); user.Status != models.UserStatusActive || user.CTFTimeUserID != 1001 {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	// Users unknown to other chats log in as usual.
+	stranger := &telebot.User{ID: 43, FirstName: "Bob"}
+	h.handle(joinUpdate(stranger))
+	if urls := buttonURLs(t, h.lastCall("sendMessage")); len(urls) != 1 {
+		t.Fatalf("stranger got no login button: %v", urls)
+	}
+
+	// Users banned in the chat they verified in aren't trusted.
+	banned, err := h.store.GetOrCreateUser(ctx, -100456, 44, models.UserStatusJustJoined)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := h.store.OnUserAuthorized(ctx, banned.ID, models.CTFTimeProfile{UserID: 1002}); err != nil {
+		t.Fatalf("authorizing user: %v", err)
+	}
+	if err := h.store.SetUserStatus(ctx, banned.ID, models.UserStatusBanned); err != nil {
+		t.Fatalf("banning user: %v", err)
+	}
+	h.handle(joinUpdate(&telebot.User{ID: 44, FirstName: "Eve"}))
+	if urls := buttonURLs(t, h.lastCall("sendMessage")); len(urls) != 1 {
+		t.Fatalf("banned user got no login button: %v", urls)
+	}
+}
+
+func TestScenarioTrustedVerificationRejected(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.TrustVerifications = true
+	h.cfg.CTFTimeAccountLimit = 1
+
+	ctx := context.Background()
+	verify := func(chatID, telegramID, ctftimeUserID int64) {
+		t.Helper()
+		user, err := h.store.GetOrCreateUser(ctx, chatID, telegramID, models.UserStatusJustJoined)
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		if err := h.store.OnUserAuthorized(ctx, user.ID, models.CTFTimeProfile{UserID: ctftimeUserID}); err != nil {
+			t.Fatalf("authorizing user: %v", err)
+		}
+	}
+
+	// The CTFTime account has already verified another Telegram account in the chat.
+	verify(testChatID, 43, 1001)
+	verify(-100456, testUser.ID, 1001)
+
+	h.handle(joinUpdate(testUser))
+	if urls := buttonURLs(t, h.lastCall("sendMessage")); len(urls) != 1 {
+		t.Fatalf("user over the account limit got no login button: %v", urls)
+	}
+	if user := h.user(); user.Status != models.UserStatusJustJoined || user.CTFTimeUserID != 0 {
+		t.Fatalf("user over the account limit was trusted: %+v", user)
+	}
+
+	// The account is banned by the federation of the chat it verified in.
+	other, err := h.store.GetOrCreateChatState(ctx, -100456, telebot.ChatSuperGroup)
+	if err != nil {
+		t.Fatalf("getting chat state: %v", err)
+	}
+	federation := &models.Federation{Name: "other", OwnerID: testAdmin.ID}
+	if err := h.store.CreateFederation(ctx, federation); err != nil {
+		t.Fatalf("creating federation: %v", err)
+	}
+	other.FederationID = &federation.ID
+	if err := h.store.UpdateChatFederation(ctx, other); err != nil {
+		t.Fatalf("updating chat federation: %v", err)
+	}
+	if err := h.store.AddFederationBan(ctx, &models.FederationBan{FederationID: federation.ID, TelegramID: 44}); err != nil {
+		t.Fatalf("adding federation ban: %v", err)
+	}
+	verify(-100456, 44, 1002)
+
+	h.handle(joinUpdate(&telebot.User{ID: 44, FirstName: "Eve"}))
+	if urls := buttonURLs(t, h.lastCall("sendMessage")); len(urls) != 1 {
+		t.Fatalf("federation banned user got no login button: %v", urls)
+	}
+}
+
+func TestScenarioAccountLimit(t *testing.T) {
+	h := newHarness(t)
+	h.cfg.CTFTimeAccountLimit = 1
+	h.setAdmins(testAdmin)
+
+	ctx := context.Background()
+	bob, err := h.store.GetOrCreateUser(ctx, testChatID, 43, models.UserStatusJustJoined)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := h.store.SetUserUsername(ctx, bob.ID, "bob"); err != nil {
+		t.Fatalf("setting username: %v", err)
+	}
+	if err := h.store.OnUserAuthorized(ctx, bob.ID, models.CTFTimeProfile{UserID: 1337, Name: "player"}); err != nil {
+		t.Fatalf("authorizing user: %v", err)
+	}
+
+	h.handle(joinUpdate(testUser))
+	h.handle(privateMessageUpdate(testUser, "/start "+strconv.Itoa(testChatID)))
+	callbackURL := h.login(buttonURLs(t, h.lastCall("sendMessage"))[0], 1337)
+
+	h.tg.Reset()
+	if code := h.callback(callbackURL); code != http.StatusForbidden {
+		t.Fatalf("callback returned %d, want 403", code)
+	}
+
+	notification := h.lastCall("sendMessage")
+	if notification.Param("chat_id") != strconv.FormatInt(testAdmin.ID, 10) {
+		t.Fatalf("notification sent to %s, want the admin", notification.Param("chat_id"))
+	}
+	for _, want := range []string{"player (https://ctftime.org/user/1337)", "@alice (42)", "@bob (43)"} {
+		if !strings.Contains(notification.Param("text"), want) {
+			t.Fatalf("notification %q doesn't mention %s", notification.Param("text"), want)
+		}
+	}
+	if calls := h.tg.Calls("restrictChatMember"); len(calls) != 0 {
+		t.Fatalf("restrictions were lifted: %v", calls)
+	}
+	if user := h.user(); user.Status != models.UserStatusJustJoined || user.CTFTimeUserID != 0 {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	// Logging in again doesn't notify the admins again.
+	h.handle(privateMessageUpdate(testUser, "/start "+strconv.Itoa(testChatID)))
+	callbackURL = h.login(buttonURLs(t, h.lastCall("sendMessage"))[0], 1337)
+
+	h.tg.Reset()
+	if code := h.callback(callbackURL); code != http.StatusForbidden {
+		t.Fatalf("callback returned %d, want 403", code)
+	}
+	if calls := h.tg.Calls("sendMessage"); len(calls) != 0 {
+		t.Fatalf("admins were notified again: %v", calls)
+	}
+}
+
+func TestFakeServerGetUpdates(t *testing.T) {
+	tg := tgtest.NewServer()
+	defer tg.Close()
+
+	bot, err := tg.NewBot()
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+
+	received := make(chan telebot.Update, 1)
+	bot.Handle(telebot.OnText, func(c telebot.Context) error {
+		received <- c.Update()
+		return nil
+	})
+
+	tg.PushUpdate(chatMessageUpdate(testUser, 1, "polled"))
+
+	go bot.Start()
+	defer bot.Stop()
+
+	select {
+	case update := <-received:
+		if !strings.Contains(update.Message.Text, "polled") {
+			t.Fatalf("unexpected update %+v", update)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("update was not polled")
+	}
+}
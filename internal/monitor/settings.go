@@ -0,0 +1,274 @@
+package monitor
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"gopkg.in/telebot.v4"
+)
+
+type settingsField string
+
+const (
+	settingsFieldProvider      settingsField = "provider"
+	settingsFieldTimeout       settingsField = "timeout"
+	settingsFieldTimeoutAction settingsField = "timeout_action"
+	settingsFieldAdminButtons  settingsField = "admin_buttons"
+	settingsFieldJoinRequests  settingsField = "join_requests"
+	settingsFieldTrust         settingsField = "trust"
+	settingsFieldAccountLimit  settingsField = "account_limit"
+	settingsFieldLanguage      settingsField = "language"
+	settingsFieldWarnMute      settingsField = "warn_mute"
+	settingsFieldWarnBan       settingsField = "warn_ban"
+	settingsFieldWarnExpiry    settingsField = "warn_expiry"
+	settingsFieldReset         settingsField = "reset"
+	settingsFieldClose         settingsField = "close"
+)
+
+// settingsTimeouts are the login timeouts the settings menu cycles through.
+var settingsTimeouts = []time.Duration{
+	5 * time.Minute,
+	10 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+}
+
+// Warning escalation thresholds and expiries the settings menu cycles through, zero is off or never.
+var (
+	settingsWarnMuteThresholds = []int{0, 2, 3, 4, 5}
+	settingsWarnBanThresholds  = []int{0, 3, 5, 7, 10}
+	settingsWarnExpiries       = []time.Duration{0, 7 * 24 * time.Hour, 30 * 24 * time.Hour, 90 * 24 * time.Hour}
+)
+
+// settingsAccountLimits are the limits of Telegram accounts per CTFTime account, zero is unlimited.
+var settingsAccountLimits = []int{0, 1, 2, 3, 5}
+
+// nextSetting returns the value following the current one, wrapping around.
+func nextSetting[T comparable](values []T, current T) T {
+	if i := slices.Index(values, current); i >= 0 && i+1 < len(values) {
+		return values[i+1]
+	}
+	return values[0]
+}
+
+func (m *Monitor) HandleSettingsCommand(uc *UpdateContext) error {
+	uc.L().Info("handling settings command")
+
+	text, markup := m.renderSettings(uc.ChatState(), uc.Lang())
+	if _, err := uc.Bot().Reply(uc.Message(), text, markup); err != nil {
+		return fmt.Errorf("sending settings menu: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Monitor) HandleSettingsCallbackAction(uc *UpdateContext) error {
+	uc.L().Infof("handling settings callback action, data %v", uc.Callback().Data)
+
+	if err := m.checkSenderAdmin(uc); err != nil {
+		uc.L().Warnf("sender is not an admin: %v", err)
+		if err := uc.Respond(&telebot.CallbackResponse{
+			Text: uc.Lang().T(i18n.NotAdmin, err),
+		}); err != nil {
+			uc.L().Errorf("failed to respond: %v", err)
+		}
+		return nil
+	}
+
+	chatState := uc.ChatState()
+	settings := &chatState.Settings
+	effective := chatState.EffectiveSettings(m.config.ChatDefaults())
+
+	field := settingsField(CallbackActionSettings.Payload(uc.Callback().Data))
+	switch field {
+	case settingsFieldProvider:
+		provider := models.VerificationProviderAdmin
+		if effective.VerificationProvider == models.VerificationProviderAdmin {
+			provider = models.VerificationProviderCTFTime
+		}
+		settings.VerificationProvider = &provider
+
+	case settingsFieldTimeout:
+		next := nextSetting(settingsTimeouts, effective.JoinLoginTimeout)
+		settings.JoinLoginTimeout = &next
+
+	case settingsFieldTimeoutAction:
+		action := models.TimeoutActionBan
+		if effective.TimeoutAction == models.TimeoutActionBan {
+			action = models.TimeoutActionKick
+		}
+		settings.TimeoutAction = &action
+
+	case settingsFieldAdminButtons:
+		show := !effective.ShowAdminButtons
+		settings.ShowAdminButtons = &show
+
+	case settingsFieldJoinRequests:
+		enabled := !effective.JoinRequestsEnabled
+		settings.JoinRequestsEnabled = &enabled
+
+	case settingsFieldTrust:
+		trust := !effective.TrustVerifications
+		settings.TrustVerifications = &trust
+
+	case settingsFieldAccountLimit:
+		limit := nextSetting(settingsAccountLimits, effective.CTFTimeAccountLimit)
+		settings.CTFTimeAccountLimit = &limit
+
+	case settingsFieldWarnMute:
+		threshold := nextSetting(settingsWarnMuteThresholds, effective.WarnMuteThreshold)
+		settings.WarnMuteThreshold = &threshold
+
+	case settingsFieldWarnBan:
+		threshold := nextSetting(settingsWarnBanThresholds, effective.WarnBanThreshold)
+		settings.WarnBanThreshold = &threshold
+
+	case settingsFieldWarnExpiry:
+		expiry := nextSetting(settingsWarnExpiries, effective.WarnExpiry)
+		settings.WarnExpiry = &expiry
+
+	case settingsFieldLanguage:
+		language := string(nextSetting(i18n.Supported(), uc.Lang()))
+		settings.Language = &language
+
+	case settingsFieldReset:
+		*settings = models.ChatSettings{}
+
+	case settingsFieldClose:
+		m.deleteMessageChecked(uc.Callback().Message, uc.L())
+		if err := uc.Respond(); err != nil {
+			uc.L().Errorf("failed to respond: %v", err)
+		}
+		return nil
+
+	default:
+		uc.L().Warnf("unexpected settings field: %v", field)
+		if err := uc.Respond(&telebot.CallbackResponse{Text: uc.Lang().T(i18n.BadCallbackData)}); err != nil {
+			uc.L().Errorf("failed to respond: %v", err)
+		}
+		return nil
+	}
+
+	if err := m.storage.UpdateChatSettings(uc, chatState); err != nil {
+		return fmt.Errorf("updating chat settings: %w", err)
+	}
+
+	uc.L().Infof("updated chat settings field %v", field)
+
+	lang := i18n.ParseOr(chatState.EffectiveSettings(m.config.ChatDefaults()).Language, uc.Lang())
+
+	text, markup := m.renderSettings(chatState, lang)
+	if _, err := uc.Bot().Edit(uc.Callback().Message, text, markup); err != nil {
+		uc.L().Errorf("failed to edit settings menu: %v", err)
+	}
+
+	if err := uc.Respond(&telebot.CallbackResponse{Text: lang.T(i18n.Saved)}); err != nil {
+		uc.L().Errorf("failed to respond: %v", err)
+	}
+
+	return nil
+}
+
+func (m *Monitor) renderSettings(chatState *models.ChatState, lang i18n.Lang) (string, *telebot.ReplyMarkup) {
+	settings := chatState.EffectiveSettings(m.config.ChatDefaults())
+
+	greeting := lang.T(i18n.GreetingDefault)
+	if settings.GreetingTemplate != "" {
+		greeting = lang.T(i18n.GreetingCustom)
+	}
+
+	provider := lang.T(i18n.ProviderCTFTime)
+	if settings.VerificationProvider == models.VerificationProviderAdmin {
+		provider = lang.T(i18n.ProviderAdmin)
+	}
+
+	timeoutAction := lang.T(i18n.TimeoutActionKick)
+	if settings.TimeoutAction == models.TimeoutActionBan {
+		timeoutAction = lang.T(i18n.TimeoutActionBan)
+	}
+
+	onOff := func(v bool) string {
+		if v {
+			return lang.T(i18n.On)
+		}
+		return lang.T(i18n.Off)
+	}
+
+	threshold := func(v int) string {
+		if v <= 0 {
+			return lang.T(i18n.Off)
+		}
+		return strconv.Itoa(v)
+	}
+
+	expiry := func(v time.Duration) string {
+		if v <= 0 {
+			return lang.T(i18n.Never)
+		}
+		return lang.Duration(v)
+	}
+
+	var (
+		verificationText  = lang.T(i18n.SettingsVerification, provider)
+		timeoutText       = lang.T(i18n.SettingsTimeout, lang.Duration(settings.JoinLoginTimeout))
+		timeoutActionText = lang.T(i18n.SettingsTimeoutAction, timeoutAction)
+		adminButtonsText  = lang.T(i18n.SettingsAdminButtons, onOff(settings.ShowAdminButtons))
+		joinRequestsText  = lang.T(i18n.SettingsJoinRequests, onOff(settings.JoinRequestsEnabled))
+		trustText         = lang.T(i18n.SettingsTrust, onOff(settings.TrustVerifications))
+		accountLimitText  = lang.T(i18n.SettingsAccountLimit, threshold(settings.CTFTimeAccountLimit))
+		warnMuteText      = lang.T(i18n.SettingsWarnMute, threshold(settings.WarnMuteThreshold))
+		warnBanText       = lang.T(i18n.SettingsWarnBan, threshold(settings.WarnBanThreshold))
+		warnExpiryText    = lang.T(i18n.SettingsWarnExpiry, expiry(settings.WarnExpiry))
+		languageText      = lang.T(i18n.SettingsLanguage, lang.T(i18n.LanguageName))
+	)
+
+	text := strings.Join([]string{
+		lang.T(i18n.SettingsTitle),
+		"",
+		verificationText,
+		timeoutText,
+		timeoutActionText,
+		adminButtonsText,
+		joinRequestsText,
+		trustText,
+		accountLimitText,
+		warnMuteText,
+		warnBanText,
+		warnExpiryText,
+		languageText,
+		lang.T(i18n.SettingsGreeting, greeting),
+		"",
+		lang.T(i18n.SettingsHint),
+	}, "\n")
+
+	markup := &telebot.ReplyMarkup{}
+	button := func(text string, field settingsField) telebot.Btn {
+		return markup.Data(text, CallbackActionSettings.String(), string(field))
+	}
+
+	markup.Inline(
+		markup.Row(button(verificationText, settingsFieldProvider)),
+		markup.Row(button(timeoutText, settingsFieldTimeout)),
+		markup.Row(button(timeoutActionText, settingsFieldTimeoutAction)),
+		markup.Row(button(adminButtonsText, settingsFieldAdminButtons)),
+		markup.Row(button(joinRequestsText, settingsFieldJoinRequests)),
+		markup.Row(button(trustText, settingsFieldTrust)),
+		markup.Row(button(accountLimitText, settingsFieldAccountLimit)),
+		markup.Row(button(warnMuteText, settingsFieldWarnMute)),
+		markup.Row(button(warnBanText, settingsFieldWarnBan)),
+		markup.Row(button(warnExpiryText, settingsFieldWarnExpiry)),
+		markup.Row(button(languageText, settingsFieldLanguage)),
+		markup.Row(
+			button(lang.T(i18n.SettingsReset), settingsFieldReset),
+			button(lang.T(i18n.SettingsClose), settingsFieldClose),
+		),
+	)
+
+	return text, markup
+}
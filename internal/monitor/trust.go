@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"gopkg.in/telebot.v4"
+)
+
+// trustedVerification returns the sender's user verified with CTFTime in any chat,
+// or nil if there is none or the chat doesn't trust verifications from other chats.
+func (m *Monitor) trustedVerification(uc *UpdateContext, settings models.EffectiveSettings) *models.User {
+	if !settings.TrustVerifications {
+		return nil
+	}
+
+	verified, err := m.storage.GetVerifiedUser(uc, uc.Chat().ID, uc.Sender().ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		uc.L().Errorf("failed to get verified user: %v", err)
+		return nil
+	}
+
+	return verified
+}
+
+// trustVerification marks the user as verified with the CTFTime account of the verified one,
+// reporting false if the CTFTime account has reached the account limit of the chat.
+func (m *Monitor) trustVerification(
+	uc *UpdateContext,
+	user, verified *models.User,
+	settings models.EffectiveSettings,
+) (bool, error) {
+	others, err := m.storage.OnUserAuthorizedWithinLimit(uc, user.ID, verified.CTFTimeProfile(), settings.CTFTimeAccountLimit)
+	if err != nil {
+		return false, fmt.Errorf("saving authorization: %w", err)
+	}
+	// The CTFTime account must not let in more Telegram accounts than the chat allows.
+	if len(others) > 0 {
+		uc.L().Infof("CTFTime user %d has reached the account limit, not trusting", verified.CTFTimeUserID)
+		return false, nil
+	}
+
+	uc.L().Infof("trusting verification as CTFTime user %d from chat %d", verified.CTFTimeUserID, verified.ChatID)
+	metrics.Verifications.WithLabelValues("trusted").Inc()
+
+	if err := m.storage.CancelVerificationDeadline(uc, user.ID); err != nil {
+		uc.L().Errorf("failed to cancel verification deadline: %v", err)
+	}
+
+	return true, nil
+}
+
+// acceptTrustedMember lets the joined member in, posting a short note instead of the greeting.
+// It reports false if the verification can't be trusted, then the member is verified as usual.
+func (m *Monitor) acceptTrustedMember(
+	uc *UpdateContext,
+	user, verified *models.User,
+	settings models.EffectiveSettings,
+) (bool, error) {
+	if trusted, err := m.trustVerification(uc, user, verified, settings); !trusted || err != nil {
+		return false, err
+	}
+
+	msg, err := uc.Bot().Send(
+		uc.Chat(),
+		uc.Lang().T(i18n.TrustedVerified, senderName(uc), verified.CTFTimeProfile().Identity()),
+		telebot.NoPreview,
+	)
+	if err != nil {
+		return true, fmt.Errorf("sending verified note: %w", err)
+	}
+
+	// The note is cleaned up like greetings.
+	expiresAt := time.Now().Add(settings.JoinLoginTimeout)
+	if err := m.storage.AddMessage(uc, &models.Message{
+		ChatID:           uc.Chat().ID,
+		MessageID:        strconv.Itoa(msg.ID),
+		MessageType:      models.MessageTypeGreeting,
+		AssociatedUserID: user.ID,
+		ExpiresAt:        &expiresAt,
+	}); err != nil {
+		return true, fmt.Errorf("adding verified note to db: %w", err)
+	}
+
+	return true, nil
+}
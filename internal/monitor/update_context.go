@@ -3,6 +3,7 @@ package monitor
 import (
 	"context"
 
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
 	"github.com/C4T-BuT-S4D/shpaga/internal/models"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/telebot.v4"
@@ -11,11 +12,20 @@ import (
 type UpdateContext struct {
 	context.Context
 	tc        telebot.Context
+	bot       telebot.API
 	log       *logrus.Entry
 	chatState *models.ChatState
+	lang      i18n.Lang
 }
 
-func NewUpdateContext(c context.Context, tc telebot.Context, chatState *models.ChatState) *UpdateContext {
+// NewUpdateContext creates the context of the update, bot is used for all requests instead of the one of tc.
+func NewUpdateContext(
+	c context.Context,
+	tc telebot.Context,
+	bot telebot.API,
+	chatState *models.ChatState,
+	lang i18n.Lang,
+) *UpdateContext {
 	fields := logrus.Fields{
 		"update.id": tc.Update().ID,
 	}
@@ -33,7 +43,9 @@ func NewUpdateContext(c context.Context, tc telebot.Context, chatState *models.C
 	return &UpdateContext{
 		Context:   c,
 		tc:        tc,
+		bot:       bot,
 		chatState: chatState,
+		lang:      lang,
 		log:       logrus.WithFields(fields),
 	}
 }
@@ -55,12 +67,36 @@ func (uc *UpdateContext) ChatState() *models.ChatState {
 	return uc.chatState
 }
 
+// Lang is the language of messages sent to the chat of the update.
+func (uc *UpdateContext) Lang() i18n.Lang {
+	return uc.lang
+}
+
+// UserLang is the language of messages sent privately to the sender.
+func (uc *UpdateContext) UserLang() i18n.Lang {
+	if uc.Sender() == nil {
+		return uc.lang
+	}
+	return i18n.ParseOr(uc.Sender().LanguageCode, uc.lang)
+}
+
 func (uc *UpdateContext) TC() telebot.Context {
 	return uc.tc
 }
 
 func (uc *UpdateContext) Bot() telebot.API {
-	return uc.tc.Bot()
+	return uc.bot
+}
+
+// Send sends the message to the chat of the update.
+func (uc *UpdateContext) Send(what any, opts ...any) error {
+	_, err := uc.bot.Send(uc.Chat(), what, opts...)
+	return err
+}
+
+// Respond answers the callback query of the update.
+func (uc *UpdateContext) Respond(resp ...*telebot.CallbackResponse) error {
+	return uc.bot.Respond(uc.Callback(), resp...)
 }
 
 func (uc *UpdateContext) Message() *telebot.Message {
@@ -78,3 +114,7 @@ func (uc *UpdateContext) Sender() *telebot.User {
 func (uc *UpdateContext) Callback() *telebot.Callback {
 	return uc.tc.Callback()
 }
+
+func (uc *UpdateContext) ChatJoinRequest() *telebot.ChatJoinRequest {
+	return uc.tc.ChatJoinRequest()
+}
@@ -0,0 +1,187 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+)
+
+// HandleWarnCommand warns the user, muting or banning them when the active warnings reach the chat thresholds.
+func (m *Monitor) HandleWarnCommand(uc *UpdateContext, args string) error {
+	uc.L().Info("handling warn command")
+
+	target, reason, ok, err := m.resolveModerationTarget(uc, "warn", args)
+	if err != nil {
+		return fmt.Errorf("resolving target: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	user, err := m.moderationUser(uc, target)
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+
+	settings := uc.ChatState().EffectiveSettings(m.config.ChatDefaults())
+	now := time.Now()
+
+	warning := &models.Warning{
+		UserID:     user.ID,
+		IssuerID:   uc.Sender().ID,
+		IssuerName: senderName(uc),
+		Reason:     reason,
+	}
+	if settings.WarnExpiry > 0 {
+		expiresAt := now.Add(settings.WarnExpiry)
+		warning.ExpiresAt = &expiresAt
+	}
+	if err := m.storage.AddWarning(uc, warning); err != nil {
+		return fmt.Errorf("adding warning: %w", err)
+	}
+
+	warnings, err := m.storage.GetActiveWarnings(uc, user.ID, now)
+	if err != nil {
+		return fmt.Errorf("getting warnings: %w", err)
+	}
+	count := len(warnings)
+
+	uc.L().Infof("user %v warned, %d active warnings", target, count)
+	metrics.AdminActions.WithLabelValues("warn").Inc()
+
+	lang := uc.Lang()
+	lines := []string{lang.T(i18n.WarnIssued, target, senderName(uc), count, reasonOrDefault(lang, reason))}
+
+	var (
+		action  moderationAction
+		muteFor time.Duration
+	)
+	switch {
+	case settings.WarnBanThreshold > 0 && count >= settings.WarnBanThreshold:
+		action = moderationBan
+		lines = append(lines, lang.T(i18n.WarnEscalatedBan, count))
+	case settings.WarnMuteThreshold > 0 && count >= settings.WarnMuteThreshold:
+		action, muteFor = moderationMute, m.config.WarnMuteDuration
+		lines = append(lines, lang.T(i18n.WarnEscalatedMute, lang.Duration(muteFor), count))
+	}
+
+	if action != "" {
+		if err := m.moderate(uc, action, user, muteFor); errors.Is(err, errPendingVerification) {
+			uc.L().Infof("not muting user %v pending verification", target)
+			lines[len(lines)-1] = lang.T(i18n.ModerationMutePending, target)
+		} else if err != nil {
+			uc.L().Warnf("telegram rejected %v of user %v: %v", action, target, err)
+			lines[len(lines)-1] = lang.T(i18n.ModerationFailed, err)
+		}
+	}
+
+	m.deleteMessageChecked(uc.Message(), uc.L())
+
+	if err := uc.Send(strings.Join(lines, "\n")); err != nil {
+		return fmt.Errorf("sending confirmation: %w", err)
+	}
+
+	return nil
+}
+
+// HandleWarnsCommand lists the active warnings of the user.
+func (m *Monitor) HandleWarnsCommand(uc *UpdateContext, args string) error {
+	uc.L().Info("handling warns command")
+
+	target, _, ok, err := m.resolveModerationTarget(uc, "warns", args)
+	if err != nil {
+		return fmt.Errorf("resolving target: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	warnings, err := m.activeWarnings(uc, target)
+	if err != nil {
+		return fmt.Errorf("getting warnings: %w", err)
+	}
+
+	lang := uc.Lang()
+	if len(warnings) == 0 {
+		m.replyCommand(uc, lang.T(i18n.WarnsNone, target))
+		return nil
+	}
+
+	lines := []string{lang.T(i18n.WarnsTitle, target, len(warnings))}
+	for i, warning := range warnings {
+		lines = append(lines, lang.T(
+			i18n.WarnsItem,
+			i+1,
+			warning.CreatedAt.UTC().Format(time.DateOnly),
+			warning.IssuerName,
+			reasonOrDefault(lang, warning.Reason),
+		))
+	}
+
+	m.replyCommand(uc, strings.Join(lines, "\n"))
+	return nil
+}
+
+// HandleUnwarnCommand revokes the latest active warning of the user.
+func (m *Monitor) HandleUnwarnCommand(uc *UpdateContext, args string) error {
+	uc.L().Info("handling unwarn command")
+
+	target, _, ok, err := m.resolveModerationTarget(uc, "unwarn", args)
+	if err != nil {
+		return fmt.Errorf("resolving target: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	warnings, err := m.activeWarnings(uc, target)
+	if err != nil {
+		return fmt.Errorf("getting warnings: %w", err)
+	}
+	if len(warnings) == 0 {
+		m.replyCommand(uc, uc.Lang().T(i18n.WarnsNone, target))
+		return nil
+	}
+
+	last := warnings[len(warnings)-1]
+	if err := m.storage.DeleteWarning(uc, last.ID); err != nil {
+		return fmt.Errorf("deleting warning: %w", err)
+	}
+
+	uc.L().Infof("revoked %v of user %v", last, target)
+	metrics.AdminActions.WithLabelValues("unwarn").Inc()
+
+	m.deleteMessageChecked(uc.Message(), uc.L())
+
+	if err := uc.Send(uc.Lang().T(i18n.WarnRevoked, target, senderName(uc), len(warnings)-1)); err != nil {
+		return fmt.Errorf("sending confirmation: %w", err)
+	}
+
+	return nil
+}
+
+// activeWarnings returns the active warnings of the target, users never seen in the chat have none.
+func (m *Monitor) activeWarnings(uc *UpdateContext, target moderationTarget) ([]*models.Warning, error) {
+	user, err := m.storage.GetChatUser(uc, uc.Chat().ID, target.id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting user: %w", err)
+	}
+
+	return m.storage.GetActiveWarnings(uc, user.ID, time.Now())
+}
+
+func reasonOrDefault(lang i18n.Lang, reason string) string {
+	if reason == "" {
+		return lang.T(i18n.WarnNoReason)
+	}
+	return reason
+}
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/i18n"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"gopkg.in/telebot.v4"
+)
+
+// HandleWhoisCommand shows the Telegram identity of the user and the CTFTime profile they logged in with.
+func (m *Monitor) HandleWhoisCommand(uc *UpdateContext, args string) error {
+	uc.L().Info("handling whois command")
+
+	lang := uc.Lang()
+
+	target, _, err := m.moderationTarget(uc, args)
+	switch {
+	case errors.Is(err, errNoTarget):
+		m.replyCommand(uc, lang.T(i18n.ModerationNoTarget, "whois"))
+		return nil
+	case errors.Is(err, errUnknownUser):
+		m.replyCommand(uc, lang.T(i18n.ModerationUnknownUser, strings.Fields(args)[0]))
+		return nil
+	case err != nil:
+		return fmt.Errorf("resolving target: %w", err)
+	}
+
+	user, err := m.storage.GetChatUser(uc, uc.Chat().ID, target.id)
+	if errors.Is(err, storage.ErrNotFound) {
+		m.replyCommand(uc, lang.T(i18n.WhoisUnknown, target))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+
+	identity := target.String()
+	if user.Username != "" && !strings.EqualFold(target.name, "@"+user.Username) {
+		identity += ", @" + user.Username
+	}
+
+	lines := []string{
+		lang.T(i18n.WhoisTelegram, identity),
+		lang.T(i18n.WhoisStatus, user.Status),
+	}
+
+	if user.CTFTimeUserID == 0 {
+		lines = append(lines, lang.T(i18n.WhoisNotVerified))
+	} else {
+		verifiedAt := lang.T(i18n.WhoisUnknownTime)
+		if user.VerifiedAt != nil {
+			verifiedAt = user.VerifiedAt.UTC().Format(time.DateTime) + " UTC"
+		}
+		lines = append(lines,
+			lang.T(i18n.WhoisVerified, verifiedAt),
+			lang.T(i18n.WhoisCTFTime, user.CTFTimeProfile().Identity()),
+		)
+		if user.CTFTimeCountry != "" {
+			lines = append(lines, lang.T(i18n.WhoisCountry, user.CTFTimeCountry))
+		}
+		if len(user.CTFTimeTeams) > 0 {
+			teams := make([]string, 0, len(user.CTFTimeTeams))
+			for _, team := range user.CTFTimeTeams {
+				teams = append(teams, team.Name)
+			}
+			lines = append(lines, lang.T(i18n.WhoisTeams, strings.Join(teams, ", ")))
+		}
+	}
+
+	if _, err := uc.Bot().Reply(uc.Message(), strings.Join(lines, "\n"), telebot.NoPreview); err != nil {
+		return fmt.Errorf("sending whois: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package oauthmock is a stand-in for the CTFTime OAuth provider,
+// used in tests and for running the whole login flow offline.
+package oauthmock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/authutil"
+	"github.com/sirupsen/logrus"
+)
+
+// User is returned by /user, the fields match the CTFTime API.
+type User struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Country string `json:"country"`
+	Team    *Team  `json:"team,omitempty"`
+}
+
+type Team struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type grant struct {
+	user          User
+	redirectURI   string
+	codeChallenge string
+}
+
+// Server implements /authorize, /token and /user.
+// Any user can be logged in by entering their id on the authorize page.
+type Server struct {
+	// ClientID and ClientSecret are checked by /token if not empty.
+	ClientID     string
+	ClientSecret string
+
+	mu     sync.Mutex
+	codes  map[string]grant
+	tokens map[string]User
+}
+
+func New(clientID, clientSecret string) *Server {
+	return &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		codes:        make(map[string]grant),
+		tokens:       make(map[string]User),
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /authorize", s.handleAuthorizePage)
+	mux.HandleFunc("POST /authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /token", s.handleToken)
+	mux.HandleFunc("GET /user", s.handleUser)
+	return mux
+}
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Mock CTFTime login</title></head>
+<body>
+<h1>Mock CTFTime login</h1>
+<form method="post" action="/authorize">
+{{ range $name, $value := .Query }}<input type="hidden" name="{{ $name }}" value="{{ index $value 0 }}">
+{{ end }}<p><label>User id <input name="user_id" value="1" required></label></p>
+<p><label>Name <input name="name" value="mock_user"></label></p>
+<p><label>Country <input name="country" value="RU"></label></p>
+<p><label>Team id <input name="team_id" value="1"></label></p>
+<p><label>Team name <input name="team_name" value="mock_team"></label></p>
+<p><button type="submit">Authorize</button></p>
+</form>
+</body>
+</html>
+`))
+
+func (s *Server) handleAuthorizePage(w http.ResponseWriter, r *http.Request) {
+	if s.ClientID != "" && r.URL.Query().Get("client_id") != s.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := authorizeTemplate.Execute(w, struct{ Query url.Values }{r.URL.Query()}); err != nil {
+		logrus.Errorf("rendering authorize page: %v", err)
+	}
+}
+
+// handleAuthorize issues a code for the user from the form and redirects back to the client.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := strconv.ParseInt(r.Form.Get("user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user_id", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if method := r.Form.Get("code_challenge_method"); method != "" && method != "S256" {
+		http.Error(w, "unsupported code_challenge_method", http.StatusBadRequest)
+		return
+	}
+
+	user := User{
+		ID:      userID,
+		Name:    r.Form.Get("name"),
+		Country: r.Form.Get("country"),
+	}
+	if teamID := r.Form.Get("team_id"); teamID != "" {
+		id, err := strconv.ParseInt(teamID, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid team_id", http.StatusBadRequest)
+			return
+		}
+		user.Team = &Team{ID: id, Name: r.Form.Get("team_name")}
+	}
+
+	code := randomString()
+
+	s.mu.Lock()
+	s.codes[code] = grant{
+		user:          user,
+		redirectURI:   redirectURI.String(),
+		codeChallenge: r.Form.Get("code_challenge"),
+	}
+	s.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	// The bot sends the parameters in the query, real clients use the form.
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	if (s.ClientID != "" && r.Form.Get("client_id") != s.ClientID) ||
+		(s.ClientSecret != "" && r.Form.Get("client_secret") != s.ClientSecret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := r.Form.Get("code")
+	g, ok := s.codes[code]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	// Codes are single-use even if the exchange fails.
+	delete(s.codes, code)
+
+	if r.Form.Get("redirect_uri") != g.redirectURI {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	if g.codeChallenge != "" && authutil.CodeChallenge(r.Form.Get("code_verifier")) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := randomString()
+	s.tokens[token] = g.user
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+	})
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+
+	s.mu.Lock()
+	user, ok := s.tokens[token]
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
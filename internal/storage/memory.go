@@ -0,0 +1,869 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/google/uuid"
+	"gopkg.in/telebot.v4"
+)
+
+const queryLimit = 100
+
+type federationBanKey struct {
+	federationID string
+	telegramID   int64
+}
+
+type chatTelegramKey struct {
+	chatID     int64
+	telegramID int64
+}
+
+type messageKey struct {
+	chatID    int64
+	messageID string
+}
+
+// Memory keeps everything in process memory, for tests and the dev mode.
+type Memory struct {
+	mu sync.Mutex
+
+	globalState *models.GlobalState
+	chatStates  map[int64]*models.ChatState
+	users       map[string]*models.User
+	usersByChat map[chatTelegramKey]string
+	messages    map[messageKey]*models.Message
+	oauthStates map[string]*models.OAuthState
+	deadlines   map[string]*models.VerificationDeadline
+	warnings    map[string]*models.Warning
+
+	federations       map[string]*models.Federation
+	federationBans    map[federationBanKey]*models.FederationBan
+	federationActions map[chatTelegramKey]*models.FederationAction
+
+	accountLimitNotices map[models.AccountLimitNotice]bool
+	raidStates          map[int64]*models.RaidState
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		chatStates:  make(map[int64]*models.ChatState),
+		users:       make(map[string]*models.User),
+		usersByChat: make(map[chatTelegramKey]string),
+		messages:    make(map[messageKey]*models.Message),
+		oauthStates: make(map[string]*models.OAuthState),
+		deadlines:   make(map[string]*models.VerificationDeadline),
+		warnings:    make(map[string]*models.Warning),
+
+		federations:       make(map[string]*models.Federation),
+		federationBans:    make(map[federationBanKey]*models.FederationBan),
+		federationActions: make(map[chatTelegramKey]*models.FederationAction),
+
+		accountLimitNotices: make(map[models.AccountLimitNotice]bool),
+		raidStates:          make(map[int64]*models.RaidState),
+	}
+}
+
+func (s *Memory) Ping(context.Context) error {
+	return nil
+}
+
+func (s *Memory) Migrate(context.Context) error {
+	return nil
+}
+
+func (s *Memory) GetOrCreateGlobalState(context.Context) (*models.GlobalState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.globalState == nil {
+		s.globalState = &models.GlobalState{ID: 1}
+	}
+	return clone(s.globalState), nil
+}
+
+func (s *Memory) GetGlobalState(context.Context) (*models.GlobalState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.globalState == nil {
+		return nil, fmt.Errorf("getting global state: %w", ErrNotFound)
+	}
+	return clone(s.globalState), nil
+}
+
+func (s *Memory) UpdateLastUpdate(_ context.Context, updateID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.globalState != nil {
+		now := time.Now()
+		s.globalState.LastUpdateID = updateID
+		s.globalState.LastUpdateAt = &now
+	}
+	return nil
+}
+
+func (s *Memory) GetOrCreateChatState(_ context.Context, chatID int64, chatType telebot.ChatType) (*models.ChatState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.chatStates[chatID]
+	if !ok {
+		state = &models.ChatState{
+			ChatID:    chatID,
+			ChatType:  chatType,
+			CreatedAt: time.Now(),
+		}
+		s.chatStates[chatID] = state
+	}
+	return clone(state), nil
+}
+
+func (s *Memory) GetChatStates(context.Context) ([]*models.ChatState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]*models.ChatState, 0, len(s.chatStates))
+	for _, state := range s.chatStates {
+		res = append(res, clone(state))
+	}
+	slices.SortFunc(res, func(a, b *models.ChatState) int {
+		return cmp.Compare(a.ChatID, b.ChatID)
+	})
+	return res, nil
+}
+
+func (s *Memory) GetChatState(_ context.Context, chatID int64) (*models.ChatState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.chatStates[chatID]
+	if !ok {
+		return nil, fmt.Errorf("getting chat state: %w", ErrNotFound)
+	}
+	return clone(state), nil
+}
+
+func (s *Memory) UpdateChatMembers(_ context.Context, chatState *models.ChatState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.chatStates[chatState.ChatID]; ok {
+		state.Member = chatState.Member
+		state.Admins = slices.Clone(chatState.Admins)
+	}
+	return nil
+}
+
+func (s *Memory) UpdateChatSettings(_ context.Context, chatState *models.ChatState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.chatStates[chatState.ChatID]; ok {
+		state.Settings = chatState.Settings
+	}
+	return nil
+}
+
+func (s *Memory) UpdateChatFederation(_ context.Context, chatState *models.ChatState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.chatStates[chatState.ChatID]; ok {
+		state.FederationID = chatState.FederationID
+	}
+	return nil
+}
+
+func (s *Memory) GetFederationChats(_ context.Context, federationID string) ([]*models.ChatState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []*models.ChatState
+	for _, state := range s.chatStates {
+		if state.FederationID != nil && *state.FederationID == federationID {
+			res = append(res, clone(state))
+		}
+	}
+	slices.SortFunc(res, func(a, b *models.ChatState) int {
+		return cmp.Compare(a.ChatID, b.ChatID)
+	})
+	return res, nil
+}
+
+func (s *Memory) GetUser(_ context.Context, userID string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("getting user: %w", ErrNotFound)
+	}
+	return clone(user), nil
+}
+
+func (s *Memory) GetChatUser(_ context.Context, chatID, telegramID int64) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, ok := s.usersByChat[chatTelegramKey{chatID, telegramID}]
+	if !ok {
+		return nil, fmt.Errorf("getting user: %w", ErrNotFound)
+	}
+	return clone(s.users[userID]), nil
+}
+
+func (s *Memory) GetChatUserByUsername(_ context.Context, chatID int64, username string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Usernames can be passed on, the most recently updated user is the current owner.
+	var found *models.User
+	for _, user := range s.users {
+		if user.ChatID != chatID || user.Username == "" || !strings.EqualFold(user.Username, username) {
+			continue
+		}
+		if found == nil || user.UpdatedAt.After(found.UpdatedAt) {
+			found = user
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("getting user: %w", ErrNotFound)
+	}
+	return clone(found), nil
+}
+
+func (s *Memory) GetVerifiedUser(_ context.Context, chatID, telegramID int64) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if joined, ok := s.usersByChat[chatTelegramKey{chatID, telegramID}]; ok && s.users[joined].Status == models.UserStatusBanned {
+		return nil, fmt.Errorf("getting user: %w", ErrNotFound)
+	}
+	if s.federationBanned(chatID, telegramID) {
+		return nil, fmt.Errorf("getting user: %w", ErrNotFound)
+	}
+
+	var found *models.User
+	for _, user := range s.users {
+		if user.TelegramID != telegramID || user.CTFTimeUserID == 0 || user.Status == models.UserStatusBanned {
+			continue
+		}
+		if s.federationBanned(user.ChatID, telegramID) {
+			continue
+		}
+		if found == nil || user.UpdatedAt.After(found.UpdatedAt) {
+			found = user
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("getting user: %w", ErrNotFound)
+	}
+	return clone(found), nil
+}
+
+// federationBanned reports whether the federation of the chat bans the Telegram account, s.mu must be held.
+func (s *Memory) federationBanned(chatID, telegramID int64) bool {
+	chat, ok := s.chatStates[chatID]
+	if !ok || chat.FederationID == nil {
+		return false
+	}
+	_, banned := s.federationBans[federationBanKey{*chat.FederationID, telegramID}]
+	return banned
+}
+
+func (s *Memory) GetChatUsersByCTFTimeID(_ context.Context, chatID, ctftimeUserID int64) ([]*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []*models.User
+	for _, user := range s.users {
+		if user.ChatID == chatID && user.CTFTimeUserID == ctftimeUserID {
+			res = append(res, clone(user))
+		}
+	}
+	slices.SortFunc(res, func(a, b *models.User) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	if len(res) > queryLimit {
+		res = res[:queryLimit]
+	}
+	return res, nil
+}
+
+func (s *Memory) GetOrCreateUser(_ context.Context, chatID, telegramID int64, defaultStatus models.UserStatus) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := chatTelegramKey{chatID, telegramID}
+	if userID, ok := s.usersByChat[key]; ok {
+		return clone(s.users[userID]), nil
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:         uuid.New().String(),
+		ChatID:     chatID,
+		TelegramID: telegramID,
+		Status:     defaultStatus,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	s.users[user.ID] = user
+	s.usersByChat[key] = user.ID
+
+	return clone(user), nil
+}
+
+func (s *Memory) OnUserAuthorized(_ context.Context, userID string, profile models.CTFTimeProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok || !slices.Contains(pendingStatuses, user.Status) {
+		return ErrUserNotPending
+	}
+	setAuthorized(user, profile)
+	return nil
+}
+
+func (s *Memory) OnUserAuthorizedWithinLimit(
+	_ context.Context,
+	userID string,
+	profile models.CTFTimeProfile,
+	limit int,
+) ([]*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("getting user: %w", ErrNotFound)
+	}
+
+	if limit > 0 {
+		var others []*models.User
+		for _, other := range s.users {
+			if other.ChatID == user.ChatID && other.CTFTimeUserID == profile.UserID && other.TelegramID != user.TelegramID {
+				others = append(others, clone(other))
+			}
+		}
+		if len(others) >= limit {
+			slices.SortFunc(others, func(a, b *models.User) int {
+				return a.CreatedAt.Compare(b.CreatedAt)
+			})
+			if len(others) > queryLimit {
+				others = others[:queryLimit]
+			}
+			return others, nil
+		}
+	}
+
+	if !slices.Contains(pendingStatuses, user.Status) {
+		return nil, ErrUserNotPending
+	}
+	setAuthorized(user, profile)
+	return nil, nil
+}
+
+func (s *Memory) SetUserStatus(_ context.Context, userID string, status models.UserStatus) error {
+	return s.updateUser(userID, func(user *models.User) {
+		user.Status = status
+	})
+}
+
+func (s *Memory) SetPendingUserStatus(_ context.Context, userID string, status models.UserStatus) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok || !slices.Contains(pendingStatuses, user.Status) {
+		return false, nil
+	}
+	user.Status = status
+	user.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (s *Memory) SetUserRestricted(_ context.Context, userID string, restricted bool) error {
+	return s.updateUser(userID, func(user *models.User) {
+		user.Restricted = restricted
+	})
+}
+
+func (s *Memory) SetUserUsername(_ context.Context, userID, username string) error {
+	return s.updateUser(userID, func(user *models.User) {
+		user.Username = username
+	})
+}
+
+func (s *Memory) AddMessage(_ context.Context, msg *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := messageKey{msg.ChatID, msg.MessageID}
+	if _, ok := s.messages[key]; ok {
+		return fmt.Errorf("creating message: duplicate message %v", msg)
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	s.messages[key] = clone(msg)
+	return nil
+}
+
+func (s *Memory) GetMessagesForUser(
+	_ context.Context,
+	userID string,
+	chatID int64,
+	messageType models.MessageType,
+) ([]*models.Message, error) {
+	return s.findMessages(func(msg *models.Message) bool {
+		return msg.AssociatedUserID == userID && msg.ChatID == chatID && msg.MessageType == messageType
+	}), nil
+}
+
+func (s *Memory) GetExpiredMessages(_ context.Context, now, olderThan time.Time) ([]*models.Message, error) {
+	return s.findMessages(func(msg *models.Message) bool {
+		if msg.ExpiresAt != nil {
+			return msg.ExpiresAt.Before(now)
+		}
+		return msg.CreatedAt.Before(olderThan)
+	}), nil
+}
+
+func (s *Memory) DeleteMessages(_ context.Context, messages []*models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range messages {
+		delete(s.messages, messageKey{msg.ChatID, msg.MessageID})
+	}
+	return nil
+}
+
+func (s *Memory) AddOAuthState(_ context.Context, state *models.OAuthState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.oauthStates[state.Nonce]; ok {
+		return fmt.Errorf("creating oauth state: duplicate nonce %s", state.Nonce)
+	}
+	if state.CreatedAt.IsZero() {
+		state.CreatedAt = time.Now()
+	}
+	s.oauthStates[state.Nonce] = clone(state)
+	return nil
+}
+
+func (s *Memory) ConsumeOAuthState(_ context.Context, nonce string) (*models.OAuthState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.oauthStates[nonce]
+	if !ok || state.UsedAt != nil {
+		return nil, ErrOAuthStateUsed
+	}
+	now := time.Now()
+	state.UsedAt = &now
+	return clone(state), nil
+}
+
+func (s *Memory) DeleteOAuthStatesOlderThan(_ context.Context, olderThan time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for nonce, state := range s.oauthStates {
+		if state.CreatedAt.Before(olderThan) {
+			delete(s.oauthStates, nonce)
+		}
+	}
+	return nil
+}
+
+func (s *Memory) DeleteUserOAuthStates(_ context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for nonce, state := range s.oauthStates {
+		if state.UserID == userID {
+			delete(s.oauthStates, nonce)
+		}
+	}
+	return nil
+}
+
+func (s *Memory) CreateFederation(_ context.Context, federation *models.Federation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if federation.ID == "" {
+		federation.ID = uuid.New().String()
+	}
+	if _, ok := s.federations[federation.ID]; ok {
+		return fmt.Errorf("creating federation: duplicate id %s", federation.ID)
+	}
+	if federation.CreatedAt.IsZero() {
+		federation.CreatedAt = time.Now()
+	}
+	s.federations[federation.ID] = clone(federation)
+	return nil
+}
+
+func (s *Memory) GetFederation(_ context.Context, federationID string) (*models.Federation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	federation, ok := s.federations[federationID]
+	if !ok {
+		return nil, fmt.Errorf("getting federation: %w", ErrNotFound)
+	}
+	return clone(federation), nil
+}
+
+func (s *Memory) AddFederationBan(_ context.Context, ban *models.FederationBan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ban.CreatedAt.IsZero() {
+		ban.CreatedAt = time.Now()
+	}
+	s.federationBans[federationBanKey{ban.FederationID, ban.TelegramID}] = clone(ban)
+	return nil
+}
+
+func (s *Memory) GetFederationBan(_ context.Context, federationID string, telegramID int64) (*models.FederationBan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ban, ok := s.federationBans[federationBanKey{federationID, telegramID}]
+	if !ok {
+		return nil, fmt.Errorf("getting federation ban: %w", ErrNotFound)
+	}
+	return clone(ban), nil
+}
+
+func (s *Memory) DeleteFederationBan(_ context.Context, federationID string, telegramID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.federationBans, federationBanKey{federationID, telegramID})
+	return nil
+}
+
+func (s *Memory) QueueFederationActions(_ context.Context, actions []*models.FederationAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, action := range actions {
+		if action.CreatedAt.IsZero() {
+			action.CreatedAt = time.Now()
+		}
+		s.federationActions[chatTelegramKey{chatID: action.ChatID, telegramID: action.TelegramID}] = clone(action)
+	}
+	return nil
+}
+
+// ClaimDueFederationActions leases the due actions under the lock, like the single statement of Postgres.
+func (s *Memory) ClaimDueFederationActions(
+	_ context.Context,
+	now time.Time,
+	lease time.Duration,
+) ([]*models.FederationAction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var actions []*models.FederationAction
+	for _, action := range s.federationActions {
+		if action.NextAttemptAt.Before(now) {
+			actions = append(actions, action)
+		}
+	}
+	slices.SortFunc(actions, func(a, b *models.FederationAction) int {
+		return a.NextAttemptAt.Compare(b.NextAttemptAt)
+	})
+	if len(actions) > queryLimit {
+		actions = actions[:queryLimit]
+	}
+	slices.SortFunc(actions, func(a, b *models.FederationAction) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	res := make([]*models.FederationAction, 0, len(actions))
+	for _, action := range actions {
+		action.NextAttemptAt = now.Add(lease)
+		res = append(res, clone(action))
+	}
+	return res, nil
+}
+
+func (s *Memory) CompleteFederationAction(_ context.Context, action *models.FederationAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := chatTelegramKey{chatID: action.ChatID, telegramID: action.TelegramID}
+	if stored, ok := s.federationActions[key]; ok && stored.CreatedAt.Equal(action.CreatedAt) {
+		delete(s.federationActions, key)
+	}
+	return nil
+}
+
+func (s *Memory) RetryFederationAction(
+	_ context.Context,
+	action *models.FederationAction,
+	retryAt time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := chatTelegramKey{chatID: action.ChatID, telegramID: action.TelegramID}
+	if stored, ok := s.federationActions[key]; ok && stored.CreatedAt.Equal(action.CreatedAt) {
+		stored.Attempts++
+		stored.NextAttemptAt = retryAt
+	}
+	return nil
+}
+
+func (s *Memory) AddWarning(_ context.Context, warning *models.Warning) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if warning.ID == "" {
+		warning.ID = uuid.New().String()
+	}
+	if _, ok := s.warnings[warning.ID]; ok {
+		return fmt.Errorf("creating warning: duplicate id %s", warning.ID)
+	}
+	if warning.CreatedAt.IsZero() {
+		warning.CreatedAt = time.Now()
+	}
+	s.warnings[warning.ID] = clone(warning)
+	return nil
+}
+
+func (s *Memory) GetActiveWarnings(_ context.Context, userID string, now time.Time) ([]*models.Warning, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []*models.Warning
+	for _, warning := range s.warnings {
+		if warning.UserID == userID && (warning.ExpiresAt == nil || !warning.ExpiresAt.Before(now)) {
+			res = append(res, clone(warning))
+		}
+	}
+	slices.SortFunc(res, func(a, b *models.Warning) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	if len(res) > queryLimit {
+		res = res[:queryLimit]
+	}
+	return res, nil
+}
+
+func (s *Memory) DeleteWarning(_ context.Context, warningID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.warnings, warningID)
+	return nil
+}
+
+func (s *Memory) DeleteExpiredWarnings(_ context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, warning := range s.warnings {
+		if warning.ExpiresAt != nil && warning.ExpiresAt.Before(now) {
+			delete(s.warnings, id)
+		}
+	}
+	return nil
+}
+
+func (s *Memory) AddAccountLimitNotice(_ context.Context, notice *models.AccountLimitNotice) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := models.AccountLimitNotice{
+		ChatID:        notice.ChatID,
+		CTFTimeUserID: notice.CTFTimeUserID,
+		TelegramID:    notice.TelegramID,
+	}
+	if s.accountLimitNotices[key] {
+		return false, nil
+	}
+	if notice.CreatedAt.IsZero() {
+		notice.CreatedAt = time.Now()
+	}
+	s.accountLimitNotices[key] = true
+	return true, nil
+}
+
+func (s *Memory) UpdateRaidState(
+	_ context.Context,
+	chatID int64,
+	update func(state *models.RaidState),
+) (*models.RaidState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.raidStates[chatID]
+	if !ok {
+		state = &models.RaidState{ChatID: chatID}
+		s.raidStates[chatID] = state
+	}
+	update(state)
+
+	res := clone(state)
+	res.Joins = slices.Clone(state.Joins)
+	return res, nil
+}
+
+func (s *Memory) EndQuietRaids(_ context.Context, activeBefore, inactiveBefore time.Time) ([]*models.RaidState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ended []*models.RaidState
+	for chatID, state := range s.raidStates {
+		switch {
+		case state.Active && state.LastJoinAt.Before(activeBefore):
+			ended = append(ended, state)
+			delete(s.raidStates, chatID)
+		case !state.Active && state.LastJoinAt.Before(inactiveBefore):
+			delete(s.raidStates, chatID)
+		}
+	}
+	return ended, nil
+}
+
+func (s *Memory) ScheduleVerificationDeadline(_ context.Context, userID string, dueAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadlines[userID] = &models.VerificationDeadline{
+		UserID:    userID,
+		DueAt:     dueAt,
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (s *Memory) CancelVerificationDeadline(_ context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deadlines, userID)
+	return nil
+}
+
+// ClaimDueVerificationDeadlines leases the due deadlines under the lock, like the single statement of Postgres.
+func (s *Memory) ClaimDueVerificationDeadlines(
+	_ context.Context,
+	now time.Time,
+	lease time.Duration,
+) ([]*models.VerificationDeadline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deadlines []*models.VerificationDeadline
+	for _, deadline := range s.deadlines {
+		if deadline.DueAt.Before(now) && (deadline.ClaimedUntil == nil || deadline.ClaimedUntil.Before(now)) {
+			deadlines = append(deadlines, deadline)
+		}
+	}
+	slices.SortFunc(deadlines, func(a, b *models.VerificationDeadline) int {
+		return a.DueAt.Compare(b.DueAt)
+	})
+	if len(deadlines) > queryLimit {
+		deadlines = deadlines[:queryLimit]
+	}
+
+	claimedUntil := now.Add(lease)
+	res := make([]*models.VerificationDeadline, 0, len(deadlines))
+	for _, deadline := range deadlines {
+		deadline.ClaimedUntil = &claimedUntil
+		res = append(res, clone(deadline))
+	}
+	return res, nil
+}
+
+func (s *Memory) CompleteVerificationDeadline(_ context.Context, deadline *models.VerificationDeadline) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.deadlines[deadline.UserID]; ok && stored.DueAt.Equal(deadline.DueAt) {
+		delete(s.deadlines, deadline.UserID)
+	}
+	return nil
+}
+
+func (s *Memory) ReleaseVerificationDeadline(
+	_ context.Context,
+	deadline *models.VerificationDeadline,
+	retryAt time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.deadlines[deadline.UserID]; ok && stored.DueAt.Equal(deadline.DueAt) {
+		stored.ClaimedUntil = &retryAt
+	}
+	return nil
+}
+
+func (s *Memory) updateUser(userID string, update func(user *models.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Like UPDATE ... WHERE, a missing user is not an error.
+	if user, ok := s.users[userID]; ok {
+		update(user)
+		user.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// setAuthorized applies OnUserAuthorized to the stored user.
+func setAuthorized(user *models.User, profile models.CTFTimeProfile) {
+	now := time.Now()
+	user.CTFTimeUserID = profile.UserID
+	user.CTFTimeName = profile.Name
+	user.CTFTimeCountry = profile.Country
+	user.CTFTimeTeams = slices.Clone(profile.Teams)
+	user.VerifiedAt = &now
+	user.Status = models.UserStatusActive
+	user.UpdatedAt = now
+}
+
+func (s *Memory) findMessages(match func(msg *models.Message) bool) []*models.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []*models.Message
+	for _, msg := range s.messages {
+		if match(msg) {
+			res = append(res, clone(msg))
+		}
+	}
+	slices.SortFunc(res, func(a, b *models.Message) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	if len(res) > queryLimit {
+		res = res[:queryLimit]
+	}
+	return res
+}
+
+// clone makes a shallow copy, nested values are replaced, not mutated, by the callers.
+func clone[T any](v *T) *T {
+	c := *v
+	return &c
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationsLockID serializes migrations of the bot and the API starting at the same time.
+const migrationsLockID = 0x536870616761
+
+var (
+	ErrSchemaTooNew      = errors.New("database schema is newer than the binary")
+	ErrNothingToRollBack = errors.New("no migrations to roll back")
+)
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes a known migration and whether it is applied.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+func loadMigrations() ([]*migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, entry := range entries {
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing version of %q: %w", entry.Name(), err)
+		}
+
+		content, err := migrationsFS.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	res := make([]*migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		res = append(res, m)
+	}
+	slices.SortFunc(res, func(a, b *migration) int {
+		return int(a.Version - b.Version)
+	})
+
+	return res, nil
+}
+
+// Migrate applies pending migrations, refusing to run against a newer schema.
+func (s *Postgres) Migrate(ctx context.Context) error {
+	if _, err := s.MigrateUp(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MigrateUp applies all pending migrations in a single transaction and returns them.
+func (s *Postgres) MigrateUp(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []MigrationStatus
+	if err := s.inMigrationTx(ctx, func(tx *gorm.DB, current map[int64]schemaMigration) error {
+		if err := checkSchemaVersion(migrations, current); err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := current[m.Version]; ok {
+				continue
+			}
+
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", m.Version, m.Name, err)
+			}
+
+			record := schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("recording migration %d_%s: %w", m.Version, m.Name, err)
+			}
+
+			applied = append(applied, MigrationStatus{Version: m.Version, Name: m.Name, AppliedAt: &record.AppliedAt})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// MigrateDown rolls back the latest applied migration and returns it.
+func (s *Postgres) MigrateDown(ctx context.Context) (*MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted *MigrationStatus
+	if err := s.inMigrationTx(ctx, func(tx *gorm.DB, current map[int64]schemaMigration) error {
+		if err := checkSchemaVersion(migrations, current); err != nil {
+			return err
+		}
+
+		for _, m := range slices.Backward(migrations) {
+			if _, ok := current[m.Version]; !ok {
+				continue
+			}
+
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", m.Version, m.Name, err)
+			}
+
+			if err := tx.Delete(&schemaMigration{Version: m.Version}).Error; err != nil {
+				return fmt.Errorf("removing migration record %d_%s: %w", m.Version, m.Name, err)
+			}
+
+			reverted = &MigrationStatus{Version: m.Version, Name: m.Name}
+			return nil
+		}
+		return ErrNothingToRollBack
+	}); err != nil {
+		return nil, err
+	}
+
+	return reverted, nil
+}
+
+// MigrationsStatus lists the known migrations and the applied ones unknown to the binary.
+func (s *Postgres) MigrationsStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	// The status is read-only, a database that was never migrated has no schema_migrations.
+	db := s.getDB(ctx)
+	current := make(map[int64]schemaMigration)
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		if current, err = appliedMigrations(db); err != nil {
+			return nil, err
+		}
+	}
+
+	var res []MigrationStatus
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if record, ok := current[m.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+			delete(current, m.Version)
+		}
+		res = append(res, status)
+	}
+	for _, record := range current {
+		res = append(res, MigrationStatus{Version: record.Version, Name: record.Name, AppliedAt: &record.AppliedAt})
+	}
+
+	slices.SortFunc(res, func(a, b MigrationStatus) int {
+		return int(a.Version - b.Version)
+	})
+	return res, nil
+}
+
+func (s *Postgres) inMigrationTx(ctx context.Context, f func(tx *gorm.DB, current map[int64]schemaMigration) error) error {
+	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationsLockID).Error; err != nil {
+			return fmt.Errorf("acquiring migrations lock: %w", err)
+		}
+
+		if err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    bigint PRIMARY KEY,
+			name       text NOT NULL,
+			applied_at timestamptz NOT NULL
+		)`).Error; err != nil {
+			return fmt.Errorf("creating schema_migrations: %w", err)
+		}
+
+		current, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+
+		return f(tx, current)
+	}); err != nil {
+		return fmt.Errorf("in tx: %w", err)
+	}
+	return nil
+}
+
+func appliedMigrations(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var records []schemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("getting applied migrations: %w", err)
+	}
+
+	current := make(map[int64]schemaMigration, len(records))
+	for _, record := range records {
+		current[record.Version] = record
+	}
+	return current, nil
+}
+
+func checkSchemaVersion(migrations []*migration, current map[int64]schemaMigration) error {
+	latest := migrations[len(migrations)-1].Version
+	for version, record := range current {
+		if version > latest {
+			return fmt.Errorf("%w: migration %d_%s is applied, latest known is %d", ErrSchemaTooNew, version, record.Name, latest)
+		}
+	}
+	return nil
+}
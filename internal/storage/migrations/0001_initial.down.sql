@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS global_states;
+DROP TABLE IF EXISTS chat_states;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,38 @@
+-- Tables are created only if missing to adopt databases created by GORM AutoMigrate.
+
+CREATE TABLE IF NOT EXISTS users (
+    id              uuid PRIMARY KEY,
+    chat_id         bigint,
+    telegram_id     bigint,
+    ctftime_user_id bigint,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    status          text
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_telegram ON users (chat_id, telegram_id);
+
+CREATE TABLE IF NOT EXISTS chat_states (
+    chat_id    bigint PRIMARY KEY,
+    chat_type  text,
+    created_at timestamptz,
+    member     jsonb,
+    admins     jsonb
+);
+
+CREATE TABLE IF NOT EXISTS global_states (
+    id             bigserial PRIMARY KEY,
+    last_update_id bigint
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    chat_id            bigint,
+    message_id         text,
+    message_type       text,
+    associated_user_id text,
+    created_at         timestamptz,
+    PRIMARY KEY (chat_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_associated_user_id ON messages (associated_user_id);
+CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages (created_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS o_auth_states (
+    nonce         text PRIMARY KEY,
+    user_id       uuid,
+    code_verifier text,
+    created_at    timestamptz,
+    used_at       timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_o_auth_states_user_id ON o_auth_states (user_id);
+CREATE INDEX IF NOT EXISTS idx_o_auth_states_created_at ON o_auth_states (created_at);
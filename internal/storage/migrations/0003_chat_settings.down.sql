@@ -0,0 +1,8 @@
+ALTER TABLE global_states DROP COLUMN IF EXISTS last_update_at;
+
+ALTER TABLE chat_states DROP COLUMN IF EXISTS settings;
+
+DROP INDEX IF EXISTS idx_messages_expires_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS expires_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS restricted;
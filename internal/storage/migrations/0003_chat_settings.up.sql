@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS restricted boolean;
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages (expires_at);
+
+ALTER TABLE chat_states ADD COLUMN IF NOT EXISTS settings jsonb;
+
+ALTER TABLE global_states ADD COLUMN IF NOT EXISTS last_update_at timestamptz;
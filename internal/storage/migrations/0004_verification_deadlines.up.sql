@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS verification_deadlines (
+    user_id    uuid PRIMARY KEY,
+    due_at     timestamptz NOT NULL,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_verification_deadlines_due_at ON verification_deadlines (due_at);
+
+-- Deadlines of pending users were derived from their greetings and join request messages.
+INSERT INTO verification_deadlines (user_id, due_at, created_at)
+SELECT u.id, max(COALESCE(m.expires_at, m.created_at + interval '10 minutes')), now()
+FROM users u
+JOIN messages m ON m.associated_user_id = u.id::text
+WHERE u.status IN ('just_joined', 'join_requested')
+  AND m.message_type IN ('greeting', 'join_request')
+GROUP BY u.id
+ON CONFLICT (user_id) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_chat_username;
+ALTER TABLE users DROP COLUMN IF EXISTS username;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_users_chat_username ON users (chat_id, lower(username));
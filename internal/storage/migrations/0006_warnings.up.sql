@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS warnings (
+    id          uuid PRIMARY KEY,
+    user_id     uuid,
+    issuer_id   bigint,
+    issuer_name text,
+    reason      text,
+    created_at  timestamptz,
+    expires_at  timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_warnings_user_id ON warnings (user_id);
+CREATE INDEX IF NOT EXISTS idx_warnings_expires_at ON warnings (expires_at);
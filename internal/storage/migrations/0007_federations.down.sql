@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_chat_states_federation_id;
+ALTER TABLE chat_states DROP COLUMN IF EXISTS federation_id;
+
+DROP TABLE IF EXISTS federation_bans;
+DROP TABLE IF EXISTS federations;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS federations (
+    id         uuid PRIMARY KEY,
+    name       text,
+    owner_id   bigint,
+    created_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS federation_bans (
+    federation_id uuid,
+    telegram_id   bigint,
+    chat_id       bigint,
+    banned_by     bigint,
+    created_at    timestamptz,
+    PRIMARY KEY (federation_id, telegram_id)
+);
+
+ALTER TABLE chat_states ADD COLUMN IF NOT EXISTS federation_id uuid;
+CREATE INDEX IF NOT EXISTS idx_chat_states_federation_id ON chat_states (federation_id);
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_users_telegram_id ON users (telegram_id);
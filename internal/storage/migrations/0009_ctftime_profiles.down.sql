@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS verified_at;
+ALTER TABLE users DROP COLUMN IF EXISTS ctftime_teams;
+ALTER TABLE users DROP COLUMN IF EXISTS ctftime_country;
+ALTER TABLE users DROP COLUMN IF EXISTS ctftime_name;
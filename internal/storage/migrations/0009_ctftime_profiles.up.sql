@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ctftime_name text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ctftime_country text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ctftime_teams jsonb;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_at timestamptz;
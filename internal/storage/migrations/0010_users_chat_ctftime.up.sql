@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_users_chat_ctftime ON users (chat_id, ctftime_user_id);
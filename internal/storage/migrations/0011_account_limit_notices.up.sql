@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS account_limit_notices (
+    chat_id         bigint,
+    ctftime_user_id bigint,
+    telegram_id     bigint,
+    created_at      timestamptz,
+    PRIMARY KEY (chat_id, ctftime_user_id, telegram_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE verification_deadlines DROP COLUMN IF EXISTS claimed_until;
@@ -0,0 +1 @@
+ALTER TABLE verification_deadlines ADD COLUMN IF NOT EXISTS claimed_until timestamptz;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS federation_actions (
+    chat_id         bigint,
+    telegram_id     bigint,
+    ban             boolean NOT NULL,
+    attempts        integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    created_at      timestamptz NOT NULL,
+    PRIMARY KEY (chat_id, telegram_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_federation_actions_next_attempt_at ON federation_actions (next_attempt_at);
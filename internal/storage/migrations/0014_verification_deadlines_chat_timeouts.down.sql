@@ -0,0 +1,2 @@
+-- The recomputed deadlines are kept, they are as valid as the assumed ones.
+SELECT 1;
@@ -0,0 +1,23 @@
+-- The deadlines backfilled by 0004 assumed 10 minutes for messages saved before expires_at existed.
+-- They are recomputed with the join_login_timeout of the chat settings, stored in nanoseconds.
+-- Chats without an override keep the default of 10 minutes, SQL can't read the config of the bot.
+UPDATE verification_deadlines d
+SET due_at = legacy.due_at
+FROM (
+    SELECT u.id AS user_id, max(COALESCE(
+        m.expires_at,
+        m.created_at + COALESCE(
+            (cs.settings ->> 'join_login_timeout')::bigint / 1000 * interval '1 microsecond',
+            interval '10 minutes'
+        )
+    )) AS due_at
+    FROM users u
+    JOIN messages m ON m.associated_user_id = u.id::text
+    LEFT JOIN chat_states cs ON cs.chat_id = u.chat_id
+    WHERE u.status IN ('just_joined', 'join_requested')
+      AND m.message_type IN ('greeting', 'join_request')
+    GROUP BY u.id
+    HAVING bool_or(m.expires_at IS NULL)
+) legacy
+WHERE d.user_id = legacy.user_id
+  AND d.claimed_until IS NULL;
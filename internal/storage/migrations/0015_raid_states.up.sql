@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS raid_states (
+    chat_id            bigint PRIMARY KEY,
+    joins              jsonb,
+    last_join_at       timestamptz,
+    active             boolean NOT NULL DEFAULT false,
+    joined             integer NOT NULL DEFAULT 0,
+    language           text,
+    title              text,
+    login_timeout      bigint,
+    summary_message_id integer NOT NULL DEFAULT 0,
+    summary_updated_at timestamptz,
+    link_revoked       boolean NOT NULL DEFAULT false
+);
@@ -0,0 +1,865 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/google/uuid"
+	"gopkg.in/telebot.v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Postgres is the production storage.
+type Postgres struct {
+	db *gorm.DB
+}
+
+func NewPostgres(db *gorm.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// Ping checks the database connection.
+func (s *Postgres) Ping(ctx context.Context) error {
+	db, err := s.db.DB()
+	if err != nil {
+		return fmt.Errorf("getting sql db: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("pinging database: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) GetOrCreateGlobalState(ctx context.Context) (*models.GlobalState, error) {
+	var res models.GlobalState
+	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
+		// Optimistic check if global state exists
+		if err := tx.First(&res).Error; err == nil {
+			return nil
+		}
+
+		if err := tx.
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.GlobalState{ID: 1}).
+			Error; err != nil {
+			return fmt.Errorf("creating global state: %w", err)
+		}
+
+		if err := tx.First(&res).Error; err != nil {
+			return fmt.Errorf("getting global state: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in tx: %w", err)
+	}
+
+	return &res, nil
+}
+
+func (s *Postgres) GetGlobalState(ctx context.Context) (*models.GlobalState, error) {
+	var res models.GlobalState
+	if err := s.getDB(ctx).First(&res).Error; err != nil {
+		return nil, fmt.Errorf("getting global state: %w", err)
+	}
+	return &res, nil
+}
+
+func (s *Postgres) UpdateLastUpdate(ctx context.Context, updateID int) error {
+	if err := s.
+		getDB(ctx).
+		Model(&models.GlobalState{}).
+		Where("id = 1").
+		Updates(map[string]any{
+			"last_update_id": updateID,
+			"last_update_at": time.Now(),
+		}).
+		Error; err != nil {
+		return fmt.Errorf("updating last update: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) GetOrCreateChatState(ctx context.Context, chatID int64, chatType telebot.ChatType) (*models.ChatState, error) {
+	var res models.ChatState
+	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
+		// Optimistic check if chat state exists
+		if err := tx.Where("chat_id = ?", chatID).First(&res).Error; err == nil {
+			return nil
+		}
+
+		if err := tx.
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ChatState{
+				ChatID:   chatID,
+				ChatType: chatType,
+			}).
+			Error; err != nil {
+			return fmt.Errorf("creating chat state: %w", err)
+		}
+
+		if err := tx.Where("chat_id = ?", chatID).First(&res).Error; err != nil {
+			return fmt.Errorf("getting chat state: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in tx: %w", err)
+	}
+
+	return &res, nil
+}
+
+func (s *Postgres) GetChatStates(ctx context.Context) ([]*models.ChatState, error) {
+	var res []*models.ChatState
+	if err := s.getDB(ctx).Order("chat_id").Find(&res).Error; err != nil {
+		return nil, fmt.Errorf("getting chat states: %w", err)
+	}
+	return res, nil
+}
+
+func (s *Postgres) GetChatState(ctx context.Context, chatID int64) (*models.ChatState, error) {
+	var res models.ChatState
+	if err := s.getDB(ctx).Where("chat_id = ?", chatID).First(&res).Error; err != nil {
+		return nil, fmt.Errorf("getting chat state: %w", err)
+	}
+	return &res, nil
+}
+
+// UpdateChatMembers only updates the synced members, so that concurrent settings updates are not lost.
+func (s *Postgres) UpdateChatMembers(ctx context.Context, chatState *models.ChatState) error {
+	if err := s.
+		getDB(ctx).
+		Model(chatState).
+		Select("member", "admins").
+		Updates(chatState).
+		Error; err != nil {
+		return fmt.Errorf("updating chat members: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) UpdateChatSettings(ctx context.Context, chatState *models.ChatState) error {
+	if err := s.
+		getDB(ctx).
+		Model(chatState).
+		Select("settings").
+		Updates(chatState).
+		Error; err != nil {
+		return fmt.Errorf("updating chat settings: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) UpdateChatFederation(ctx context.Context, chatState *models.ChatState) error {
+	if err := s.
+		getDB(ctx).
+		Model(chatState).
+		Select("federation_id").
+		Updates(chatState).
+		Error; err != nil {
+		return fmt.Errorf("updating chat federation: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) GetFederationChats(ctx context.Context, federationID string) ([]*models.ChatState, error) {
+	var res []*models.ChatState
+	if err := s.
+		getDB(ctx).
+		Where("federation_id = ?", federationID).
+		Order("chat_id").
+		Find(&res).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting federation chats: %w", err)
+	}
+	return res, nil
+}
+
+func (s *Postgres) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	if err := s.getDB(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("getting user: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *Postgres) GetChatUser(ctx context.Context, chatID, telegramID int64) (*models.User, error) {
+	var user models.User
+	if err := s.
+		getDB(ctx).
+		Where("chat_id = ? AND telegram_id = ?", chatID, telegramID).
+		First(&user).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting user: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *Postgres) GetChatUserByUsername(ctx context.Context, chatID int64, username string) (*models.User, error) {
+	var user models.User
+	if err := s.
+		getDB(ctx).
+		Where("chat_id = ? AND lower(username) = lower(?) AND username <> ''", chatID, username).
+		Order("updated_at DESC").
+		First(&user).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting user: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *Postgres) GetVerifiedUser(ctx context.Context, chatID, telegramID int64) (*models.User, error) {
+	var user models.User
+	if err := s.
+		getDB(ctx).
+		Where("telegram_id = ? AND ctftime_user_id <> 0 AND status <> ?", telegramID, models.UserStatusBanned).
+		Where(`NOT EXISTS (
+			SELECT 1 FROM users joined
+			WHERE joined.chat_id = ? AND joined.telegram_id = users.telegram_id AND joined.status = ?
+		)`, chatID, models.UserStatusBanned).
+		Where(`NOT EXISTS (
+			SELECT 1 FROM federation_bans
+			JOIN chat_states ON chat_states.federation_id = federation_bans.federation_id
+			WHERE federation_bans.telegram_id = users.telegram_id AND chat_states.chat_id IN (users.chat_id, ?)
+		)`, chatID).
+		Order("updated_at DESC").
+		First(&user).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting user: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *Postgres) GetChatUsersByCTFTimeID(ctx context.Context, chatID, ctftimeUserID int64) ([]*models.User, error) {
+	var result []*models.User
+	if err := s.
+		getDB(ctx).
+		Where("chat_id = ? AND ctftime_user_id = ?", chatID, ctftimeUserID).
+		Order("created_at").
+		Limit(queryLimit).
+		Find(&result).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting users: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Postgres) GetOrCreateUser(ctx context.Context, chatID, telegramID int64, defaultStatus models.UserStatus) (*models.User, error) {
+	userToCreate := &models.User{
+		ID:         uuid.New().String(),
+		ChatID:     chatID,
+		TelegramID: telegramID,
+		Status:     defaultStatus,
+	}
+
+	var user models.User
+	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
+		// Optimistic check if user exists
+		if err := tx.
+			Where("chat_id = ? AND telegram_id = ?", chatID, telegramID).
+			First(&user).
+			Error; err == nil {
+			return nil
+		}
+
+		if err := tx.
+			Clauses(clause.OnConflict{
+				Columns: []clause.Column{
+					{Name: "chat_id"},
+					{Name: "telegram_id"},
+				},
+				DoNothing: true,
+			}).
+			Create(userToCreate).
+			Error; err != nil {
+			return fmt.Errorf("creating user: %w", err)
+		}
+
+		if err := tx.
+			Where("chat_id = ? AND telegram_id = ?", chatID, telegramID).
+			First(&user).
+			Error; err != nil {
+			return fmt.Errorf("getting user: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in tx: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (s *Postgres) OnUserAuthorized(ctx context.Context, userID string, profile models.CTFTimeProfile) error {
+	return authorizeUser(s.getDB(ctx), userID, profile)
+}
+
+func (s *Postgres) OnUserAuthorizedWithinLimit(
+	ctx context.Context,
+	userID string,
+	profile models.CTFTimeProfile,
+	limit int,
+) ([]*models.User, error) {
+	var others []*models.User
+	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return fmt.Errorf("getting user: %w", err)
+		}
+
+		if limit > 0 {
+			// Locking the chat makes concurrent logins of the chat count the accounts one by one.
+			if err := tx.
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("chat_id = ?", user.ChatID).
+				First(&models.ChatState{}).
+				Error; err != nil {
+				return fmt.Errorf("locking chat state: %w", err)
+			}
+
+			if err := tx.
+				Where("chat_id = ? AND ctftime_user_id = ? AND telegram_id <> ?", user.ChatID, profile.UserID, user.TelegramID).
+				Order("created_at").
+				Limit(queryLimit).
+				Find(&others).
+				Error; err != nil {
+				return fmt.Errorf("getting users of the CTFTime account: %w", err)
+			}
+			if len(others) >= limit {
+				return nil
+			}
+			others = nil
+		}
+
+		return authorizeUser(tx, userID, profile)
+	}); err != nil {
+		return nil, fmt.Errorf("in tx: %w", err)
+	}
+
+	return others, nil
+}
+
+func authorizeUser(db *gorm.DB, userID string, profile models.CTFTimeProfile) error {
+	teams, err := json.Marshal(profile.Teams)
+	if err != nil {
+		return fmt.Errorf("marshalling teams: %w", err)
+	}
+
+	res := db.
+		Model(&models.User{}).
+		Where("id = ? AND status IN ?", userID, pendingStatuses).
+		Updates(map[string]any{
+			"ctftime_user_id": profile.UserID,
+			"ctftime_name":    profile.Name,
+			"ctftime_country": profile.Country,
+			"ctftime_teams":   string(teams),
+			"verified_at":     time.Now(),
+			"status":          models.UserStatusActive,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("updating user: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotPending
+	}
+
+	return nil
+}
+
+func (s *Postgres) SetUserStatus(ctx context.Context, userID string, status models.UserStatus) error {
+	if err := s.
+		getDB(ctx).
+		Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]any{
+			"status": status,
+		}).
+		Error; err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) SetPendingUserStatus(ctx context.Context, userID string, status models.UserStatus) (bool, error) {
+	res := s.
+		getDB(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND status IN ?", userID, pendingStatuses).
+		Updates(map[string]any{
+			"status": status,
+		})
+	if res.Error != nil {
+		return false, fmt.Errorf("updating user: %w", res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (s *Postgres) SetUserRestricted(ctx context.Context, userID string, restricted bool) error {
+	if err := s.
+		getDB(ctx).
+		Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]any{
+			"restricted": restricted,
+		}).
+		Error; err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) SetUserUsername(ctx context.Context, userID, username string) error {
+	if err := s.
+		getDB(ctx).
+		Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]any{
+			"username": username,
+		}).
+		Error; err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Postgres) AddMessage(ctx context.Context, msg *models.Message) error {
+	if err := s.getDB(ctx).Create(msg).Error; err != nil {
+		return fmt.Errorf("creating message: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) GetMessagesForUser(
+	ctx context.Context,
+	userID string,
+	chatID int64,
+	messageType models.MessageType,
+) ([]*models.Message, error) {
+	var result []*models.Message
+	if err := s.
+		getDB(ctx).
+		Where(
+			"associated_user_id = ? AND chat_id = ? AND message_type = ?",
+			userID,
+			chatID,
+			messageType,
+		).
+		Order("created_at").
+		Limit(queryLimit).
+		Find(&result).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting message: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetExpiredMessages returns messages which expired before now.
+// Messages without explicit expiration time expire if created before olderThan.
+func (s *Postgres) GetExpiredMessages(ctx context.Context, now, olderThan time.Time) ([]*models.Message, error) {
+	var result []*models.Message
+	if err := s.
+		getDB(ctx).
+		Where("expires_at < ? OR (expires_at IS NULL AND created_at < ?)", now, olderThan).
+		Order("created_at").
+		Limit(queryLimit).
+		Find(&result).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting messages: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Postgres) DeleteMessages(ctx context.Context, messages []*models.Message) error {
+	if err := s.getDB(ctx).Delete(messages).Error; err != nil {
+		return fmt.Errorf("deleting messages: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) AddOAuthState(ctx context.Context, state *models.OAuthState) error {
+	if err := s.getDB(ctx).Create(state).Error; err != nil {
+		return fmt.Errorf("creating oauth state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOAuthState marks the state as used and returns it.
+// ErrOAuthStateUsed is returned if the state was already consumed or never existed.
+func (s *Postgres) ConsumeOAuthState(ctx context.Context, nonce string) (*models.OAuthState, error) {
+	var res []models.OAuthState
+	tx := s.
+		getDB(ctx).
+		Model(&res).
+		Clauses(clause.Returning{}).
+		Where("nonce = ? AND used_at IS NULL", nonce).
+		Update("used_at", time.Now())
+	if err := tx.Error; err != nil {
+		return nil, fmt.Errorf("updating oauth state: %w", err)
+	}
+	if len(res) == 0 {
+		return nil, ErrOAuthStateUsed
+	}
+	return &res[0], nil
+}
+
+func (s *Postgres) DeleteOAuthStatesOlderThan(ctx context.Context, olderThan time.Time) error {
+	if err := s.
+		getDB(ctx).
+		Where("created_at < ?", olderThan).
+		Delete(&models.OAuthState{}).
+		Error; err != nil {
+		return fmt.Errorf("deleting oauth states: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) DeleteUserOAuthStates(ctx context.Context, userID string) error {
+	if err := s.
+		getDB(ctx).
+		Where("user_id = ?", userID).
+		Delete(&models.OAuthState{}).
+		Error; err != nil {
+		return fmt.Errorf("deleting oauth states: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) CreateFederation(ctx context.Context, federation *models.Federation) error {
+	if federation.ID == "" {
+		federation.ID = uuid.New().String()
+	}
+	if err := s.getDB(ctx).Create(federation).Error; err != nil {
+		return fmt.Errorf("creating federation: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) GetFederation(ctx context.Context, federationID string) (*models.Federation, error) {
+	var res models.Federation
+	if err := s.getDB(ctx).Where("id = ?", federationID).First(&res).Error; err != nil {
+		return nil, fmt.Errorf("getting federation: %w", err)
+	}
+	return &res, nil
+}
+
+func (s *Postgres) AddFederationBan(ctx context.Context, ban *models.FederationBan) error {
+	if err := s.
+		getDB(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "federation_id"}, {Name: "telegram_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"chat_id", "banned_by", "created_at"}),
+		}).
+		Create(ban).
+		Error; err != nil {
+		return fmt.Errorf("creating federation ban: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) GetFederationBan(ctx context.Context, federationID string, telegramID int64) (*models.FederationBan, error) {
+	var res models.FederationBan
+	if err := s.
+		getDB(ctx).
+		Where("federation_id = ? AND telegram_id = ?", federationID, telegramID).
+		First(&res).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting federation ban: %w", err)
+	}
+	return &res, nil
+}
+
+func (s *Postgres) DeleteFederationBan(ctx context.Context, federationID string, telegramID int64) error {
+	if err := s.
+		getDB(ctx).
+		Where("federation_id = ? AND telegram_id = ?", federationID, telegramID).
+		Delete(&models.FederationBan{}).
+		Error; err != nil {
+		return fmt.Errorf("deleting federation ban: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) QueueFederationActions(ctx context.Context, actions []*models.FederationAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	if err := s.
+		getDB(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}, {Name: "telegram_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"ban", "attempts", "next_attempt_at", "created_at"}),
+		}).
+		Create(&actions).
+		Error; err != nil {
+		return fmt.Errorf("creating federation actions: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueFederationActions leases the due actions like ClaimDueVerificationDeadlines.
+func (s *Postgres) ClaimDueFederationActions(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+) ([]*models.FederationAction, error) {
+	var actions []*models.FederationAction
+	if err := s.
+		getDB(ctx).
+		Raw(`UPDATE federation_actions SET next_attempt_at = ?
+			WHERE (chat_id, telegram_id) IN (
+				SELECT chat_id, telegram_id FROM federation_actions
+				WHERE next_attempt_at < ?
+				ORDER BY next_attempt_at
+				LIMIT ?
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *`, now.Add(lease), now, queryLimit).
+		Scan(&actions).
+		Error; err != nil {
+		return nil, fmt.Errorf("claiming federation actions: %w", err)
+	}
+	// The actions are returned in the order they were queued, the due time was replaced by the lease.
+	slices.SortFunc(actions, func(a, b *models.FederationAction) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return actions, nil
+}
+
+func (s *Postgres) CompleteFederationAction(ctx context.Context, action *models.FederationAction) error {
+	if err := s.
+		getDB(ctx).
+		Where("chat_id = ? AND telegram_id = ? AND created_at = ?", action.ChatID, action.TelegramID, action.CreatedAt).
+		Delete(&models.FederationAction{}).
+		Error; err != nil {
+		return fmt.Errorf("deleting federation action: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) RetryFederationAction(
+	ctx context.Context,
+	action *models.FederationAction,
+	retryAt time.Time,
+) error {
+	if err := s.
+		getDB(ctx).
+		Model(&models.FederationAction{}).
+		Where("chat_id = ? AND telegram_id = ? AND created_at = ?", action.ChatID, action.TelegramID, action.CreatedAt).
+		Updates(map[string]any{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": retryAt,
+		}).
+		Error; err != nil {
+		return fmt.Errorf("updating federation action: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) AddWarning(ctx context.Context, warning *models.Warning) error {
+	if warning.ID == "" {
+		warning.ID = uuid.New().String()
+	}
+	if err := s.getDB(ctx).Create(warning).Error; err != nil {
+		return fmt.Errorf("creating warning: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) GetActiveWarnings(ctx context.Context, userID string, now time.Time) ([]*models.Warning, error) {
+	var result []*models.Warning
+	if err := s.
+		getDB(ctx).
+		Where("user_id = ? AND (expires_at IS NULL OR expires_at >= ?)", userID, now).
+		Order("created_at").
+		Limit(queryLimit).
+		Find(&result).
+		Error; err != nil {
+		return nil, fmt.Errorf("getting warnings: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Postgres) DeleteWarning(ctx context.Context, warningID string) error {
+	if err := s.
+		getDB(ctx).
+		Where("id = ?", warningID).
+		Delete(&models.Warning{}).
+		Error; err != nil {
+		return fmt.Errorf("deleting warning: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) DeleteExpiredWarnings(ctx context.Context, now time.Time) error {
+	if err := s.
+		getDB(ctx).
+		Where("expires_at < ?", now).
+		Delete(&models.Warning{}).
+		Error; err != nil {
+		return fmt.Errorf("deleting warnings: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) AddAccountLimitNotice(ctx context.Context, notice *models.AccountLimitNotice) (bool, error) {
+	res := s.
+		getDB(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(notice)
+	if res.Error != nil {
+		return false, fmt.Errorf("creating account limit notice: %w", res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (s *Postgres) UpdateRaidState(
+	ctx context.Context,
+	chatID int64,
+	update func(state *models.RaidState),
+) (*models.RaidState, error) {
+	var res models.RaidState
+	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RaidState{ChatID: chatID}).
+			Error; err != nil {
+			return fmt.Errorf("creating raid state: %w", err)
+		}
+
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("chat_id = ?", chatID).
+			First(&res).
+			Error; err != nil {
+			return fmt.Errorf("getting raid state: %w", err)
+		}
+
+		update(&res)
+
+		if err := tx.Save(&res).Error; err != nil {
+			return fmt.Errorf("saving raid state: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in tx: %w", err)
+	}
+
+	return &res, nil
+}
+
+func (s *Postgres) EndQuietRaids(ctx context.Context, activeBefore, inactiveBefore time.Time) ([]*models.RaidState, error) {
+	var deleted []*models.RaidState
+	if err := s.
+		getDB(ctx).
+		Raw(`DELETE FROM raid_states
+			WHERE (active AND last_join_at < ?) OR (NOT active AND last_join_at < ?)
+			RETURNING *`, activeBefore, inactiveBefore).
+		Scan(&deleted).
+		Error; err != nil {
+		return nil, fmt.Errorf("deleting raid states: %w", err)
+	}
+
+	ended := slices.DeleteFunc(deleted, func(state *models.RaidState) bool {
+		return !state.Active
+	})
+	return ended, nil
+}
+
+func (s *Postgres) ScheduleVerificationDeadline(ctx context.Context, userID string, dueAt time.Time) error {
+	if err := s.
+		getDB(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"due_at", "claimed_until", "created_at"}),
+		}).
+		Create(&models.VerificationDeadline{
+			UserID: userID,
+			DueAt:  dueAt,
+		}).
+		Error; err != nil {
+		return fmt.Errorf("creating verification deadline: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) CancelVerificationDeadline(ctx context.Context, userID string) error {
+	if err := s.
+		getDB(ctx).
+		Where("user_id = ?", userID).
+		Delete(&models.VerificationDeadline{}).
+		Error; err != nil {
+		return fmt.Errorf("deleting verification deadline: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueVerificationDeadlines leases the due deadlines in a single statement, so no locks are held
+// while they are processed. SKIP LOCKED lets multiple replicas share the work.
+func (s *Postgres) ClaimDueVerificationDeadlines(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+) ([]*models.VerificationDeadline, error) {
+	var deadlines []*models.VerificationDeadline
+	if err := s.
+		getDB(ctx).
+		Raw(`UPDATE verification_deadlines SET claimed_until = ?
+			WHERE user_id IN (
+				SELECT user_id FROM verification_deadlines
+				WHERE due_at < ? AND (claimed_until IS NULL OR claimed_until < ?)
+				ORDER BY due_at
+				LIMIT ?
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *`, now.Add(lease), now, now, queryLimit).
+		Scan(&deadlines).
+		Error; err != nil {
+		return nil, fmt.Errorf("claiming verification deadlines: %w", err)
+	}
+	// RETURNING doesn't keep the order of the subquery.
+	slices.SortFunc(deadlines, func(a, b *models.VerificationDeadline) int {
+		return a.DueAt.Compare(b.DueAt)
+	})
+	return deadlines, nil
+}
+
+func (s *Postgres) CompleteVerificationDeadline(ctx context.Context, deadline *models.VerificationDeadline) error {
+	if err := s.
+		getDB(ctx).
+		Where("user_id = ? AND due_at = ?", deadline.UserID, deadline.DueAt).
+		Delete(&models.VerificationDeadline{}).
+		Error; err != nil {
+		return fmt.Errorf("deleting verification deadline: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) ReleaseVerificationDeadline(
+	ctx context.Context,
+	deadline *models.VerificationDeadline,
+	retryAt time.Time,
+) error {
+	if err := s.
+		getDB(ctx).
+		Model(&models.VerificationDeadline{}).
+		Where("user_id = ? AND due_at = ?", deadline.UserID, deadline.DueAt).
+		Update("claimed_until", retryAt).
+		Error; err != nil {
+		return fmt.Errorf("updating verification deadline: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) getDB(ctx context.Context) *gorm.DB {
+	return s.db.WithContext(ctx)
+}
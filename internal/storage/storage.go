@@ -2,263 +2,141 @@ package storage
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/C4T-BuT-S4D/shpaga/internal/models"
-	"github.com/google/uuid"
 	"gopkg.in/telebot.v4"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
-type Storage struct {
-	db *gorm.DB
-}
-
-func New(db *gorm.DB) *Storage {
-	return &Storage{db: db}
-}
-
-func (s *Storage) Migrate(ctx context.Context) error {
-	if err := s.getDB(ctx).AutoMigrate(models.All...); err != nil {
-		return fmt.Errorf("migrating database: %w", err)
-	}
-	return nil
-}
-
-func (s *Storage) GetOrCreateGlobalState(ctx context.Context) (*models.GlobalState, error) {
-	var res models.GlobalState
-	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
-		// Optimistic check if global state exists
-		if err := tx.First(&res).Error; err == nil {
-			return nil
-		}
-
-		if err := tx.
-			Clauses(clause.OnConflict{DoNothing: true}).
-			Create(&models.GlobalState{ID: 1}).
-			Error; err != nil {
-			return fmt.Errorf("creating global state: %w", err)
-		}
-
-		if err := tx.First(&res).Error; err != nil {
-			return fmt.Errorf("getting global state: %w", err)
-		}
-
-		return nil
-	}); err != nil {
-		return nil, fmt.Errorf("in tx: %w", err)
-	}
-
-	return &res, nil
-}
-
-func (s *Storage) UpdateLastUpdate(ctx context.Context, updateID int) error {
-	if err := s.
-		getDB(ctx).
-		Model(&models.GlobalState{}).
-		Where("id = 1").
-		Update("last_update_id", updateID).
-		Error; err != nil {
-		return fmt.Errorf("updating last update: %w", err)
-	}
-	return nil
-}
-
-func (s *Storage) GetOrCreateChatState(ctx context.Context, chatID int64, chatType telebot.ChatType) (*models.ChatState, error) {
-	var res models.ChatState
-	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
-		// Optimistic check if chat state exists
-		if err := tx.Where("chat_id = ?", chatID).First(&res).Error; err == nil {
-			return nil
-		}
-
-		if err := tx.
-			Clauses(clause.OnConflict{DoNothing: true}).
-			Create(&models.ChatState{
-				ChatID:   chatID,
-				ChatType: chatType,
-			}).
-			Error; err != nil {
-			return fmt.Errorf("creating chat state: %w", err)
-		}
-
-		if err := tx.Where("chat_id = ?", chatID).First(&res).Error; err != nil {
-			return fmt.Errorf("getting chat state: %w", err)
-		}
-
-		return nil
-	}); err != nil {
-		return nil, fmt.Errorf("in tx: %w", err)
-	}
-
-	return &res, nil
-}
-
-func (s *Storage) GetChatStates(ctx context.Context) ([]*models.ChatState, error) {
-	var res []*models.ChatState
-	if err := s.getDB(ctx).Find(&res).Error; err != nil {
-		return nil, fmt.Errorf("getting chat states: %w", err)
-	}
-	return res, nil
-}
-
-func (s *Storage) UpdateChatState(ctx context.Context, chatState *models.ChatState) error {
-	if err := s.getDB(ctx).Save(chatState).Error; err != nil {
-		return fmt.Errorf("updating chat state: %w", err)
-	}
-	return nil
-}
-
-func (s *Storage) GetUser(ctx context.Context, userID string) (*models.User, error) {
-	var user models.User
-	if err := s.getDB(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("getting user: %w", err)
-	}
-	return &user, nil
-}
-
-func (s *Storage) GetChatUser(ctx context.Context, chatID, telegramID int64) (*models.User, error) {
-	var user models.User
-	if err := s.
-		getDB(ctx).
-		Where("chat_id = ? AND telegram_id = ?", chatID, telegramID).
-		First(&user).
-		Error; err != nil {
-		return nil, fmt.Errorf("getting user: %w", err)
-	}
-	return &user, nil
-}
-
-func (s *Storage) GetOrCreateUser(ctx context.Context, chatID, telegramID int64, defaultStatus models.UserStatus) (*models.User, error) {
-	userToCreate := &models.User{
-		ID:         uuid.New().String(),
-		ChatID:     chatID,
-		TelegramID: telegramID,
-		Status:     defaultStatus,
-	}
-
-	var user models.User
-	if err := s.getDB(ctx).Transaction(func(tx *gorm.DB) error {
-		// Optimistic check if user exists
-		if err := tx.
-			Where("chat_id = ? AND telegram_id = ?", chatID, telegramID).
-			First(&user).
-			Error; err == nil {
-			return nil
-		}
-
-		if err := tx.
-			Clauses(clause.OnConflict{
-				Columns: []clause.Column{
-					{Name: "chat_id"},
-					{Name: "telegram_id"},
-				},
-				DoNothing: true,
-			}).
-			Create(userToCreate).
-			Error; err != nil {
-			return fmt.Errorf("creating user: %w", err)
-		}
-
-		if err := tx.
-			Where("chat_id = ? AND telegram_id = ?", chatID, telegramID).
-			First(&user).
-			Error; err != nil {
-			return fmt.Errorf("getting user: %w", err)
-		}
-
-		return nil
-	}); err != nil {
-		return nil, fmt.Errorf("in tx: %w", err)
-	}
-
-	return &user, nil
-}
-
-func (s *Storage) OnUserAuthorized(ctx context.Context, userID string, ctftimeUserID int64) error {
-	if err := s.
-		getDB(ctx).
-		Model(&models.User{}).
-		Where("id = ?", userID).
-		Updates(map[string]any{
-			"ctftime_user_id": ctftimeUserID,
-			"status":          models.UserStatusActive,
-		}).
-		Error; err != nil {
-		return fmt.Errorf("updating user: %w", err)
-	}
-
-	return nil
-}
-
-func (s *Storage) SetUserStatus(ctx context.Context, userID string, status models.UserStatus) error {
-	if err := s.
-		getDB(ctx).
-		Model(&models.User{}).
-		Where("id = ?", userID).
-		Updates(map[string]any{
-			"status": status,
-		}).
-		Error; err != nil {
-		return fmt.Errorf("updating user: %w", err)
-	}
-
-	return nil
-}
-
-func (s *Storage) AddMessage(ctx context.Context, msg *models.Message) error {
-	if err := s.getDB(ctx).Create(msg).Error; err != nil {
-		return fmt.Errorf("creating message: %w", err)
-	}
-	return nil
-}
-
-func (s *Storage) GetMessagesForUser(
-	ctx context.Context,
-	userID string,
-	chatID int64,
-	messageType models.MessageType,
-) ([]*models.Message, error) {
-	var result []*models.Message
-	if err := s.
-		getDB(ctx).
-		Where(
-			"associated_user_id = ? AND chat_id = ? AND message_type = ?",
-			userID,
-			chatID,
-			messageType,
-		).
-		Limit(100).
-		Find(&result).
-		Error; err != nil {
-		return nil, fmt.Errorf("getting message: %w", err)
-	}
-
-	return result, nil
-}
-
-func (s *Storage) GetMessagesOlderThan(ctx context.Context, olderThan time.Time) ([]*models.Message, error) {
-	var result []*models.Message
-	if err := s.
-		getDB(ctx).
-		Where("created_at < ?", olderThan).
-		Limit(100).
-		Find(&result).
-		Error; err != nil {
-		return nil, fmt.Errorf("getting messages: %w", err)
-	}
-	return result, nil
-}
-
-func (s *Storage) DeleteMessages(ctx context.Context, messages []*models.Message) error {
-	if err := s.getDB(ctx).Delete(messages).Error; err != nil {
-		return fmt.Errorf("deleting messages: %w", err)
-	}
-	return nil
-}
+var (
+	ErrNotFound       = gorm.ErrRecordNotFound
+	ErrOAuthStateUsed = errors.New("oauth state is unknown or already used")
+	ErrUserNotPending = errors.New("user is not pending verification")
+)
 
-func (s *Storage) getDB(ctx context.Context) *gorm.DB {
-	return s.db.WithContext(ctx)
-}
+// pendingStatuses are the statuses of users who haven't passed the verification yet.
+var pendingStatuses = []models.UserStatus{
+	models.UserStatusJustJoined,
+	models.UserStatusJoinRequested,
+}
+
+// Storage is implemented by Postgres and by Memory for tests and the dev mode.
+// Returned models are copies, changes are saved only through the methods.
+type Storage interface {
+	Ping(ctx context.Context) error
+	Migrate(ctx context.Context) error
+
+	GetOrCreateGlobalState(ctx context.Context) (*models.GlobalState, error)
+	GetGlobalState(ctx context.Context) (*models.GlobalState, error)
+	UpdateLastUpdate(ctx context.Context, updateID int) error
+
+	GetOrCreateChatState(ctx context.Context, chatID int64, chatType telebot.ChatType) (*models.ChatState, error)
+	// GetChatStates returns all chats ordered by id.
+	GetChatStates(ctx context.Context) ([]*models.ChatState, error)
+	GetChatState(ctx context.Context, chatID int64) (*models.ChatState, error)
+	UpdateChatMembers(ctx context.Context, chatState *models.ChatState) error
+	UpdateChatSettings(ctx context.Context, chatState *models.ChatState) error
+	UpdateChatFederation(ctx context.Context, chatState *models.ChatState) error
+	// GetFederationChats returns the chats of the federation ordered by id.
+	GetFederationChats(ctx context.Context, federationID string) ([]*models.ChatState, error)
+
+	GetUser(ctx context.Context, userID string) (*models.User, error)
+	GetChatUser(ctx context.Context, chatID, telegramID int64) (*models.User, error)
+	// GetChatUserByUsername finds the user by the Telegram username, case-insensitively.
+	GetChatUserByUsername(ctx context.Context, chatID int64, username string) (*models.User, error)
+	// GetVerifiedUser returns the most recently updated user of the Telegram account verified with CTFTime
+	// in any chat it isn't banned in, for the account joining the chat. ErrNotFound is returned if the account
+	// is banned in the joined chat or by the federation of either chat.
+	GetVerifiedUser(ctx context.Context, chatID, telegramID int64) (*models.User, error)
+	// GetChatUsersByCTFTimeID returns the users of the chat verified with the CTFTime account, oldest first.
+	GetChatUsersByCTFTimeID(ctx context.Context, chatID, ctftimeUserID int64) ([]*models.User, error)
+	GetOrCreateUser(ctx context.Context, chatID, telegramID int64, defaultStatus models.UserStatus) (*models.User, error)
+	// OnUserAuthorized activates the user pending verification and saves the CTFTime profile,
+	// replacing the previous one. ErrUserNotPending is returned if the user was removed or verified meanwhile.
+	OnUserAuthorized(ctx context.Context, userID string, profile models.CTFTimeProfile) error
+	// OnUserAuthorizedWithinLimit is OnUserAuthorized unless the CTFTime account has already verified
+	// limit other Telegram accounts in the chat, then the user is left as is and those accounts are returned.
+	// Concurrent authorizations in the chat are serialized, a non-positive limit disables the check.
+	OnUserAuthorizedWithinLimit(
+		ctx context.Context,
+		userID string,
+		profile models.CTFTimeProfile,
+		limit int,
+	) ([]*models.User, error)
+	SetUserStatus(ctx context.Context, userID string, status models.UserStatus) error
+	// SetPendingUserStatus sets the status only if the user is still pending verification,
+	// reporting whether it was set.
+	SetPendingUserStatus(ctx context.Context, userID string, status models.UserStatus) (bool, error)
+	SetUserRestricted(ctx context.Context, userID string, restricted bool) error
+	SetUserUsername(ctx context.Context, userID, username string) error
+
+	AddMessage(ctx context.Context, msg *models.Message) error
+	// GetMessagesForUser returns at most 100 messages ordered by creation time.
+	GetMessagesForUser(ctx context.Context, userID string, chatID int64, messageType models.MessageType) ([]*models.Message, error)
+	// GetExpiredMessages returns at most 100 messages which expired before now, ordered by creation time.
+	// Messages without explicit expiration time expire if created before olderThan.
+	GetExpiredMessages(ctx context.Context, now, olderThan time.Time) ([]*models.Message, error)
+	DeleteMessages(ctx context.Context, messages []*models.Message) error
+
+	AddOAuthState(ctx context.Context, state *models.OAuthState) error
+	// ConsumeOAuthState marks the state as used and returns it.
+	// ErrOAuthStateUsed is returned if the state was already consumed or never existed.
+	ConsumeOAuthState(ctx context.Context, nonce string) (*models.OAuthState, error)
+	DeleteOAuthStatesOlderThan(ctx context.Context, olderThan time.Time) error
+	// DeleteUserOAuthStates deletes the login links of the user, so they can't be used after a removal.
+	DeleteUserOAuthStates(ctx context.Context, userID string) error
+
+	// CreateFederation saves the federation, generating the id if empty.
+	CreateFederation(ctx context.Context, federation *models.Federation) error
+	GetFederation(ctx context.Context, federationID string) (*models.Federation, error)
+	// AddFederationBan saves the ban, replacing the existing ban of the user.
+	AddFederationBan(ctx context.Context, ban *models.FederationBan) error
+	GetFederationBan(ctx context.Context, federationID string, telegramID int64) (*models.FederationBan, error)
+	DeleteFederationBan(ctx context.Context, federationID string, telegramID int64) error
+	// QueueFederationActions saves the actions, replacing the pending actions for the same users and chats.
+	QueueFederationActions(ctx context.Context, actions []*models.FederationAction) error
+	// ClaimDueFederationActions returns at most 100 actions due before now, earliest first,
+	// claiming them until now plus the lease. Actions claimed by another replica are skipped.
+	ClaimDueFederationActions(ctx context.Context, now time.Time, lease time.Duration) ([]*models.FederationAction, error)
+	// CompleteFederationAction deletes the applied action unless it was replaced meanwhile.
+	CompleteFederationAction(ctx context.Context, action *models.FederationAction) error
+	// RetryFederationAction counts the failed attempt and makes the action claimable again at retryAt
+	// unless it was replaced meanwhile.
+	RetryFederationAction(ctx context.Context, action *models.FederationAction, retryAt time.Time) error
+
+	// AddWarning saves the warning, generating the id if empty.
+	AddWarning(ctx context.Context, warning *models.Warning) error
+	// GetActiveWarnings returns at most 100 warnings of the user not expired before now, ordered by creation time.
+	GetActiveWarnings(ctx context.Context, userID string, now time.Time) ([]*models.Warning, error)
+	DeleteWarning(ctx context.Context, warningID string) error
+	DeleteExpiredWarnings(ctx context.Context, now time.Time) error
+
+	// UpdateRaidState applies update to the raid state of the chat, creating it if missing, and saves it.
+	// The state is locked during update, so joins seen by different replicas are counted one by one.
+	UpdateRaidState(ctx context.Context, chatID int64, update func(state *models.RaidState)) (*models.RaidState, error)
+	// EndQuietRaids deletes the raids without joins since activeBefore and returns them,
+	// so each raid is ended by one replica. States of chats not in raid mode without joins since
+	// inactiveBefore are deleted too.
+	EndQuietRaids(ctx context.Context, activeBefore, inactiveBefore time.Time) ([]*models.RaidState, error)
+
+	// AddAccountLimitNotice saves the notice, reporting false if it already exists.
+	AddAccountLimitNotice(ctx context.Context, notice *models.AccountLimitNotice) (bool, error)
+
+	// ScheduleVerificationDeadline sets the deadline of the user, replacing the existing one.
+	ScheduleVerificationDeadline(ctx context.Context, userID string, dueAt time.Time) error
+	CancelVerificationDeadline(ctx context.Context, userID string) error
+	// ClaimDueVerificationDeadlines returns at most 100 deadlines due before now, earliest first,
+	// claiming them until now plus the lease. Deadlines claimed by another replica are skipped.
+	ClaimDueVerificationDeadlines(ctx context.Context, now time.Time, lease time.Duration) ([]*models.VerificationDeadline, error)
+	// CompleteVerificationDeadline deletes the processed deadline unless it was rescheduled meanwhile.
+	CompleteVerificationDeadline(ctx context.Context, deadline *models.VerificationDeadline) error
+	// ReleaseVerificationDeadline makes the deadline claimable again at retryAt unless it was rescheduled meanwhile.
+	ReleaseVerificationDeadline(ctx context.Context, deadline *models.VerificationDeadline, retryAt time.Time) error
+}
+
+var (
+	_ Storage = (*Postgres)(nil)
+	_ Storage = (*Memory)(nil)
+)
@@ -0,0 +1,342 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/models"
+	"github.com/C4T-BuT-S4D/shpaga/internal/storage"
+	"github.com/google/uuid"
+	"gopkg.in/telebot.v4"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// postgresDSNEnv points the tests to a disposable database, the Postgres tests are skipped without it.
+const postgresDSNEnv = "SHPAGA_TEST_POSTGRES_DSN"
+
+// forEachStorage runs the test against Memory and, if configured, Postgres.
+// Tests use random chat and user ids, so they don't interfere with each other in a shared database.
+func forEachStorage(t *testing.T, test func(t *testing.T, store storage.Storage)) {
+	t.Helper()
+
+	t.Run("memory", func(t *testing.T) {
+		test(t, storage.NewMemory())
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv(postgresDSNEnv)
+		if dsn == "" {
+			t.Skipf("%s is not set", postgresDSNEnv)
+		}
+
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatalf("connecting to database: %v", err)
+		}
+		t.Cleanup(func() {
+			if sqlDB, err := db.DB(); err == nil {
+				_ = sqlDB.Close()
+			}
+		})
+
+		store := storage.NewPostgres(db)
+		if err := store.Migrate(context.Background()); err != nil {
+			t.Fatalf("migrating database: %v", err)
+		}
+		test(t, store)
+	})
+}
+
+func randomChatID() int64 {
+	return -1_000_000_000_000 - rand.Int64N(1_000_000_000)
+}
+
+func TestClaimDueVerificationDeadlines(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store storage.Storage) {
+		ctx := context.Background()
+		now := time.Now()
+
+		userIDs := make([]string, 20)
+		for i := range userIDs {
+			userIDs[i] = uuid.New().String()
+			if err := store.ScheduleVerificationDeadline(ctx, userIDs[i], now.Add(-time.Minute)); err != nil {
+				t.Fatalf("scheduling deadline: %v", err)
+			}
+			t.Cleanup(func() {
+				_ = store.CancelVerificationDeadline(ctx, userIDs[i])
+			})
+		}
+
+		// Concurrent cleaners claim every deadline exactly once.
+		var (
+			mu      sync.Mutex
+			claimed = make(map[string]int)
+			wg      sync.WaitGroup
+		)
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				deadlines, err := store.ClaimDueVerificationDeadlines(ctx, now, time.Minute)
+				if err != nil {
+					t.Errorf("claiming deadlines: %v", err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				for _, deadline := range deadlines {
+					claimed[deadline.UserID]++
+				}
+			}()
+		}
+		wg.Wait()
+
+		for _, userID := range userIDs {
+			if claimed[userID] != 1 {
+				t.Fatalf("deadline of %s claimed %d times, want once", userID, claimed[userID])
+			}
+		}
+
+		// Leased deadlines are claimed again only after the lease expires.
+		deadlines, err := store.ClaimDueVerificationDeadlines(ctx, now, time.Minute)
+		if err != nil {
+			t.Fatalf("claiming deadlines: %v", err)
+		}
+		if ours := ownDeadlines(deadlines, userIDs); len(ours) != 0 {
+			t.Fatalf("claimed leased deadlines %v", ours)
+		}
+
+		deadlines, err = store.ClaimDueVerificationDeadlines(ctx, now.Add(2*time.Minute), time.Minute)
+		if err != nil {
+			t.Fatalf("claiming deadlines: %v", err)
+		}
+		ours := ownDeadlines(deadlines, userIDs)
+		if len(ours) != len(userIDs) {
+			t.Fatalf("claimed %d expired leases, want %d", len(ours), len(userIDs))
+		}
+
+		// A deadline rescheduled while it's processed is kept.
+		rescheduled := ours[0].UserID
+		if err := store.ScheduleVerificationDeadline(ctx, rescheduled, now.Add(time.Hour)); err != nil {
+			t.Fatalf("rescheduling deadline: %v", err)
+		}
+		for _, deadline := range ours {
+			if err := store.CompleteVerificationDeadline(ctx, deadline); err != nil {
+				t.Fatalf("completing deadline: %v", err)
+			}
+		}
+
+		deadlines, err = store.ClaimDueVerificationDeadlines(ctx, now.Add(2*time.Hour), time.Minute)
+		if err != nil {
+			t.Fatalf("claiming deadlines: %v", err)
+		}
+		if ours := ownDeadlines(deadlines, userIDs); len(ours) != 1 || ours[0].UserID != rescheduled {
+			t.Fatalf("remaining deadlines %v, want the rescheduled one", ours)
+		}
+	})
+}
+
+func ownDeadlines(deadlines []*models.VerificationDeadline, userIDs []string) []*models.VerificationDeadline {
+	return slices.DeleteFunc(deadlines, func(deadline *models.VerificationDeadline) bool {
+		return !slices.Contains(userIDs, deadline.UserID)
+	})
+}
+
+func TestOnUserAuthorized(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store storage.Storage) {
+		ctx := context.Background()
+		chatID := randomChatID()
+
+		user, err := store.GetOrCreateUser(ctx, chatID, 42, models.UserStatusJustJoined)
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		if err := store.OnUserAuthorized(ctx, user.ID, models.CTFTimeProfile{UserID: 1337}); err != nil {
+			t.Fatalf("authorizing user: %v", err)
+		}
+		if user, err := store.GetUser(ctx, user.ID); err != nil || user.Status != models.UserStatusActive ||
+			user.CTFTimeUserID != 1337 {
+			t.Fatalf("unexpected user %+v: %v", user, err)
+		}
+
+		// A login link can't be used twice, or by a user removed meanwhile.
+		if err := store.OnUserAuthorized(ctx, user.ID, models.CTFTimeProfile{UserID: 1337}); !errors.Is(err, storage.ErrUserNotPending) {
+			t.Fatalf("authorizing an active user returned %v, want ErrUserNotPending", err)
+		}
+
+		kicked, err := store.GetOrCreateUser(ctx, chatID, 43, models.UserStatusKicked)
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		if err := store.OnUserAuthorized(ctx, kicked.ID, models.CTFTimeProfile{UserID: 1338}); !errors.Is(err, storage.ErrUserNotPending) {
+			t.Fatalf("authorizing a kicked user returned %v, want ErrUserNotPending", err)
+		}
+	})
+}
+
+func TestOnUserAuthorizedWithinLimitConcurrent(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store storage.Storage) {
+		ctx := context.Background()
+		chatID := randomChatID()
+
+		if _, err := store.GetOrCreateChatState(ctx, chatID, telebot.ChatSuperGroup); err != nil {
+			t.Fatalf("creating chat state: %v", err)
+		}
+
+		users := make([]*models.User, 8)
+		for i := range users {
+			user, err := store.GetOrCreateUser(ctx, chatID, int64(100+i), models.UserStatusJustJoined)
+			if err != nil {
+				t.Fatalf("creating user: %v", err)
+			}
+			users[i] = user
+		}
+
+		// Accounts logging in at the same time with one CTFTime account don't exceed the limit.
+		const limit = 2
+		var wg sync.WaitGroup
+		for _, user := range users {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.OnUserAuthorizedWithinLimit(ctx, user.ID, models.CTFTimeProfile{UserID: 1337}, limit); err != nil {
+					t.Errorf("authorizing user: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		verified, err := store.GetChatUsersByCTFTimeID(ctx, chatID, 1337)
+		if err != nil {
+			t.Fatalf("getting users: %v", err)
+		}
+		if len(verified) != limit {
+			t.Fatalf("%d accounts verified, want %d", len(verified), limit)
+		}
+	})
+}
+
+func TestFederationActions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store storage.Storage) {
+		ctx := context.Background()
+		chatID := randomChatID()
+		now := time.Now()
+
+		queue := func(ban bool) {
+			t.Helper()
+			if err := store.QueueFederationActions(ctx, []*models.FederationAction{{
+				ChatID:        chatID,
+				TelegramID:    42,
+				Ban:           ban,
+				NextAttemptAt: now,
+				CreatedAt:     time.Now(),
+			}}); err != nil {
+				t.Fatalf("queueing federation action: %v", err)
+			}
+		}
+		claim := func(at time.Time) []*models.FederationAction {
+			t.Helper()
+			actions, err := store.ClaimDueFederationActions(ctx, at, time.Minute)
+			if err != nil {
+				t.Fatalf("claiming federation actions: %v", err)
+			}
+			return slices.DeleteFunc(actions, func(action *models.FederationAction) bool {
+				return action.ChatID != chatID
+			})
+		}
+
+		queue(true)
+		actions := claim(now.Add(time.Second))
+		if len(actions) != 1 || !actions[0].Ban {
+			t.Fatalf("claimed %v, want the ban", actions)
+		}
+
+		// A failed action is retried later with the attempt counted.
+		if err := store.RetryFederationAction(ctx, actions[0], now.Add(time.Hour)); err != nil {
+			t.Fatalf("retrying federation action: %v", err)
+		}
+		if actions := claim(now.Add(time.Minute)); len(actions) != 0 {
+			t.Fatalf("claimed %v before the retry time", actions)
+		}
+		retried := claim(now.Add(2 * time.Hour))
+		if len(retried) != 1 || retried[0].Attempts != 1 {
+			t.Fatalf("claimed %v, want the retried ban", retried)
+		}
+
+		// An unban queued while the ban is applied replaces it and survives its completion.
+		queue(false)
+		if err := store.CompleteFederationAction(ctx, retried[0]); err != nil {
+			t.Fatalf("completing federation action: %v", err)
+		}
+		actions = claim(now.Add(time.Second))
+		if len(actions) != 1 || actions[0].Ban || actions[0].Attempts != 0 {
+			t.Fatalf("claimed %v, want the unban", actions)
+		}
+
+		if err := store.CompleteFederationAction(ctx, actions[0]); err != nil {
+			t.Fatalf("completing federation action: %v", err)
+		}
+		if actions := claim(now.Add(3 * time.Hour)); len(actions) != 0 {
+			t.Fatalf("claimed %v after completion", actions)
+		}
+	})
+}
+
+func TestRaidStates(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store storage.Storage) {
+		ctx := context.Background()
+		chatID := randomChatID()
+		now := time.Now()
+
+		// Joins registered by different replicas at the same time are all counted.
+		const joins = 10
+		var wg sync.WaitGroup
+		for range joins {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.UpdateRaidState(ctx, chatID, func(state *models.RaidState) {
+					state.Active = true
+					state.Joined++
+					state.LastJoinAt = now
+				}); err != nil {
+					t.Errorf("updating raid state: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		state, err := store.UpdateRaidState(ctx, chatID, func(*models.RaidState) {})
+		if err != nil {
+			t.Fatalf("getting raid state: %v", err)
+		}
+		if state.Joined != joins {
+			t.Fatalf("%d joins counted, want %d", state.Joined, joins)
+		}
+
+		// A quiet raid is ended once.
+		ended, err := store.EndQuietRaids(ctx, now.Add(time.Minute), now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("ending raids: %v", err)
+		}
+		if !slices.ContainsFunc(ended, func(state *models.RaidState) bool { return state.ChatID == chatID }) {
+			t.Fatalf("ended raids %v, want the chat", ended)
+		}
+
+		ended, err = store.EndQuietRaids(ctx, now.Add(time.Minute), now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("ending raids: %v", err)
+		}
+		if slices.ContainsFunc(ended, func(state *models.RaidState) bool { return state.ChatID == chatID }) {
+			t.Fatalf("raid of the chat ended twice")
+		}
+	})
+}
@@ -0,0 +1,323 @@
+// Package tgtest implements a fake Telegram Bot API server for tests.
+// It supports the subset of methods used by the bot and records every call.
+package tgtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/telebot.v4"
+)
+
+const Token = "test-token"
+
+// BotUser is returned by getMe.
+var BotUser = telebot.User{
+	ID:        1000,
+	IsBot:     true,
+	FirstName: "Shpaga",
+	Username:  "shpaga_test_bot",
+}
+
+// Call is a recorded Bot API request.
+type Call struct {
+	Method string
+	Params map[string]any
+	// MessageID is the id of the message created by sendMessage.
+	MessageID int
+}
+
+// Param returns the parameter formatted as a string, telebot sends most of them as strings anyway.
+func (c Call) Param(name string) string {
+	v, ok := c.Params[name]
+	if !ok {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// Decode decodes the parameter into v, either if it's sent as a JSON string
+// (like reply_markup) or as an object (like permissions).
+func (c Call) Decode(name string, v any) error {
+	raw := []byte(c.Param(name))
+	if _, ok := c.Params[name].(string); !ok {
+		var err error
+		if raw, err = json.Marshal(c.Params[name]); err != nil {
+			return fmt.Errorf("marshalling %s: %w", name, err)
+		}
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("unmarshalling %s: %w", name, err)
+	}
+	return nil
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	calls         []Call
+	updates       []telebot.Update
+	nextUpdateID  int
+	nextMessageID int
+	members       map[[2]int64]*telebot.ChatMember
+	admins        map[int64][]telebot.ChatMember
+	permissions   map[int64]telebot.Rights
+	failures      map[string][]failure
+}
+
+type failure struct {
+	code       int
+	retryAfter int
+}
+
+// NewServer starts the server, it must be closed by the caller.
+func NewServer() *Server {
+	s := &Server{
+		nextUpdateID:  1,
+		nextMessageID: 1,
+		members:       make(map[[2]int64]*telebot.ChatMember),
+		admins:        make(map[int64][]telebot.ChatMember),
+		permissions:   make(map[int64]telebot.Rights),
+		failures:      make(map[string][]failure),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// NewBot creates a bot talking to the server.
+func (s *Server) NewBot() (*telebot.Bot, error) {
+	return telebot.NewBot(telebot.Settings{
+		URL:    s.URL,
+		Token:  Token,
+		Poller: &telebot.LongPoller{Timeout: 10 * time.Millisecond},
+	})
+}
+
+// PushUpdate queues the update for getUpdates, assigning it an id.
+func (s *Server) PushUpdate(update telebot.Update) telebot.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update.ID = s.nextUpdateID
+	s.nextUpdateID++
+	s.updates = append(s.updates, update)
+	return update
+}
+
+// SetChatMember sets the result of getChatMember.
+func (s *Server) SetChatMember(chatID int64, member *telebot.ChatMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members[[2]int64{chatID, member.User.ID}] = member
+}
+
+// SetAdmins sets the result of getChatAdministrators.
+func (s *Server) SetAdmins(chatID int64, admins []telebot.ChatMember) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.admins[chatID] = admins
+}
+
+// SetChatPermissions sets the default permissions returned by getChat,
+// chats allow members everything by default.
+func (s *Server) SetChatPermissions(chatID int64, rights telebot.Rights) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.permissions[chatID] = rights
+}
+
+// Fail makes the next call of the method fail with the code,
+// retry_after is set if positive. Calls are recorded even if failed.
+func (s *Server) Fail(method string, code, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method] = append(s.failures[method], failure{code: code, retryAfter: retryAfter})
+}
+
+// Calls returns the recorded calls of the given methods, or all calls if none given.
+func (s *Server) Calls(methods ...string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []Call
+	for _, call := range s.calls {
+		if len(methods) == 0 || slices.Contains(methods, call.Method) {
+			res = append(res, call)
+		}
+	}
+	return res
+}
+
+// Reset forgets the recorded calls.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	prefix := "/bot" + Token + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, prefix)
+
+	params := make(map[string]any)
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	call := Call{Method: method, Params: params}
+	if method != "getUpdates" {
+		s.calls = append(s.calls, call)
+	}
+
+	if failures := s.failures[method]; len(failures) > 0 {
+		s.failures[method] = failures[1:]
+		writeFailure(w, failures[0])
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, BotUser)
+
+	case "getUpdates":
+		offset, _ := strconv.Atoi(call.Param("offset"))
+		var res []telebot.Update
+		for _, update := range s.updates {
+			if update.ID >= offset {
+				res = append(res, update)
+			}
+		}
+		writeResult(w, res)
+
+	case "sendMessage":
+		chatID, err := strconv.ParseInt(call.Param("chat_id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request: chat not found")
+			return
+		}
+		msg := telebot.Message{
+			ID:       s.nextMessageID,
+			Unixtime: time.Now().Unix(),
+			Chat:     &telebot.Chat{ID: chatID},
+			Sender:   &BotUser,
+			Text:     call.Param("text"),
+		}
+		s.nextMessageID++
+		s.calls[len(s.calls)-1].MessageID = msg.ID
+		writeResult(w, msg)
+
+	case "editMessageText":
+		chatID, _ := strconv.ParseInt(call.Param("chat_id"), 10, 64)
+		messageID, _ := strconv.Atoi(call.Param("message_id"))
+		writeResult(w, telebot.Message{
+			ID:     messageID,
+			Chat:   &telebot.Chat{ID: chatID},
+			Sender: &BotUser,
+			Text:   call.Param("text"),
+		})
+
+	case "getChat":
+		chatID, _ := strconv.ParseInt(call.Param("chat_id"), 10, 64)
+		rights, ok := s.permissions[chatID]
+		if !ok {
+			rights = telebot.NoRestrictions()
+		}
+		writeResult(w, telebot.Chat{ID: chatID, Type: telebot.ChatSuperGroup, Permissions: &rights})
+
+	case "getChatMember":
+		chatID, _ := strconv.ParseInt(call.Param("chat_id"), 10, 64)
+		userID, _ := strconv.ParseInt(call.Param("user_id"), 10, 64)
+		member, ok := s.members[[2]int64{chatID, userID}]
+		if !ok {
+			member = &telebot.ChatMember{User: &telebot.User{ID: userID}, Role: telebot.Left}
+		}
+		writeResult(w, member)
+
+	case "getChatAdministrators":
+		chatID, _ := strconv.ParseInt(call.Param("chat_id"), 10, 64)
+		admins := s.admins[chatID]
+		if admins == nil {
+			admins = []telebot.ChatMember{}
+		}
+		writeResult(w, admins)
+
+	case "exportChatInviteLink":
+		writeResult(w, fmt.Sprintf("https://t.me/+invite%d", s.nextMessageID))
+		s.nextMessageID++
+
+	case "deleteMessage",
+		"unbanChatMember",
+		"banChatMember",
+		"kickChatMember",
+		"restrictChatMember",
+		"approveChatJoinRequest",
+		"declineChatJoinRequest",
+		"answerCallbackQuery",
+		"setWebhook",
+		"deleteWebhook":
+		writeResult(w, true)
+
+	default:
+		writeError(w, http.StatusNotFound, "Not Found: method not found")
+	}
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"ok":     true,
+		"result": result,
+	})
+}
+
+func writeFailure(w http.ResponseWriter, f failure) {
+	resp := map[string]any{
+		"ok":          false,
+		"error_code":  f.code,
+		"description": http.StatusText(f.code),
+	}
+	if f.retryAfter > 0 {
+		resp["description"] = fmt.Sprintf("Too Many Requests: retry after %d", f.retryAfter)
+		resp["parameters"] = map[string]any{"retry_after": f.retryAfter}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func writeError(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"ok":          false,
+		"error_code":  code,
+		"description": description,
+	})
+}
@@ -0,0 +1,321 @@
+package tgutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"gopkg.in/telebot.v4"
+)
+
+var errorCodeRe = regexp.MustCompile(`^telegram: .* \((\d{3})\)$`)
+
+// maxChatLimiters bounds the number of per-chat limiters kept in memory.
+const maxChatLimiters = 10000
+
+// nonIdempotentMethods may take effect even if the response is lost, so they are only retried
+// when Telegram asked to or when the request was never sent.
+var nonIdempotentMethods = map[string]bool{
+	"sendMessage":     true,
+	"editMessageText": true,
+}
+
+type OutboundOptions struct {
+	// GlobalRate limits all requests, per second.
+	GlobalRate float64
+	// ChatRate limits messages sent or edited in a single chat, per minute.
+	ChatRate  float64
+	ChatBurst int
+
+	// MaxRetries is the number of retries of a failed request, zero disables retries.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled for every next one.
+	RetryBackoff time.Duration
+	// MaxRetryWait is the longest delay before a retry, requests with longer retry_after fail instantly.
+	MaxRetryWait time.Duration
+	// MaxWait bounds the time a request spends throttled and retried, zero is unbounded.
+	MaxWait time.Duration
+}
+
+// Outbound wraps the bot API, throttling requests to stay within the Telegram limits
+// and retrying requests failed with 429 (respecting retry_after), 5xx or network errors.
+// Sent messages and edits are only retried on 429 or if the request was never sent.
+// Methods not used by the bot are passed through as is.
+// Waits are cancelled with the context given to NewOutbound.
+type Outbound struct {
+	telebot.API
+
+	ctx    context.Context
+	me     *telebot.User
+	opts   OutboundOptions
+	global *rate.Limiter
+
+	mu    sync.Mutex
+	chats map[int64]*rate.Limiter
+}
+
+func NewOutbound(ctx context.Context, bot *telebot.Bot, opts OutboundOptions) *Outbound {
+	global := rate.NewLimiter(rate.Inf, 0)
+	if opts.GlobalRate > 0 {
+		global = rate.NewLimiter(rate.Limit(opts.GlobalRate), max(1, int(opts.GlobalRate)))
+	}
+
+	return &Outbound{
+		API:    bot,
+		ctx:    ctx,
+		me:     bot.Me,
+		opts:   opts,
+		global: global,
+		chats:  make(map[int64]*rate.Limiter),
+	}
+}
+
+// Me returns the bot user.
+func Me(api telebot.API) *telebot.User {
+	switch api := api.(type) {
+	case *Outbound:
+		return api.me
+	case *telebot.Bot:
+		return api.Me
+	default:
+		return &telebot.User{}
+	}
+}
+
+func (o *Outbound) Send(to telebot.Recipient, what any, opts ...any) (*telebot.Message, error) {
+	var msg *telebot.Message
+	err := o.do("sendMessage", recipientID(to), func() (err error) {
+		msg, err = o.API.Send(to, what, opts...)
+		return err
+	})
+	return msg, err
+}
+
+func (o *Outbound) Reply(to *telebot.Message, what any, opts ...any) (*telebot.Message, error) {
+	var msg *telebot.Message
+	err := o.do("sendMessage", to.Chat.ID, func() (err error) {
+		msg, err = o.API.Reply(to, what, opts...)
+		return err
+	})
+	return msg, err
+}
+
+func (o *Outbound) Edit(editable telebot.Editable, what any, opts ...any) (*telebot.Message, error) {
+	_, chatID := editable.MessageSig()
+
+	var msg *telebot.Message
+	err := o.do("editMessageText", chatID, func() (err error) {
+		msg, err = o.API.Edit(editable, what, opts...)
+		return err
+	})
+	return msg, err
+}
+
+func (o *Outbound) Delete(editable telebot.Editable) error {
+	return o.do("deleteMessage", 0, func() error {
+		return o.API.Delete(editable)
+	})
+}
+
+func (o *Outbound) Respond(c *telebot.Callback, resp ...*telebot.CallbackResponse) error {
+	return o.do("answerCallbackQuery", 0, func() error {
+		return o.API.Respond(c, resp...)
+	})
+}
+
+func (o *Outbound) Ban(chat *telebot.Chat, member *telebot.ChatMember, revokeMessages ...bool) error {
+	return o.do("banChatMember", 0, func() error {
+		return o.API.Ban(chat, member, revokeMessages...)
+	})
+}
+
+func (o *Outbound) Unban(chat *telebot.Chat, user *telebot.User, forBanned ...bool) error {
+	return o.do("unbanChatMember", 0, func() error {
+		return o.API.Unban(chat, user, forBanned...)
+	})
+}
+
+func (o *Outbound) Restrict(chat *telebot.Chat, member *telebot.ChatMember) error {
+	return o.do("restrictChatMember", 0, func() error {
+		return o.API.Restrict(chat, member)
+	})
+}
+
+func (o *Outbound) ApproveJoinRequest(chat telebot.Recipient, user *telebot.User) error {
+	return o.do("approveChatJoinRequest", 0, func() error {
+		return o.API.ApproveJoinRequest(chat, user)
+	})
+}
+
+func (o *Outbound) DeclineJoinRequest(chat telebot.Recipient, user *telebot.User) error {
+	return o.do("declineChatJoinRequest", 0, func() error {
+		return o.API.DeclineJoinRequest(chat, user)
+	})
+}
+
+func (o *Outbound) ChatMemberOf(chat, user telebot.Recipient) (*telebot.ChatMember, error) {
+	var member *telebot.ChatMember
+	err := o.do("getChatMember", 0, func() (err error) {
+		member, err = o.API.ChatMemberOf(chat, user)
+		return err
+	})
+	return member, err
+}
+
+func (o *Outbound) AdminsOf(chat *telebot.Chat) ([]telebot.ChatMember, error) {
+	var admins []telebot.ChatMember
+	err := o.do("getChatAdministrators", 0, func() (err error) {
+		admins, err = o.API.AdminsOf(chat)
+		return err
+	})
+	return admins, err
+}
+
+// do runs the request within the limits, retrying it on transient errors.
+// Messages sent to a chat (chatID != 0) are additionally limited per chat.
+func (o *Outbound) do(method string, chatID int64, request func() error) error {
+	ctx := o.ctx
+	if o.opts.MaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.opts.MaxWait)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := o.wait(ctx, chatID); err != nil {
+			metrics.TelegramFailures.WithLabelValues(method).Inc()
+			return fmt.Errorf("waiting to call %s: %w", method, err)
+		}
+
+		err := request()
+		if err == nil {
+			return nil
+		}
+
+		delay, ok := o.retryDelay(method, err, attempt)
+		if !ok {
+			metrics.TelegramFailures.WithLabelValues(method).Inc()
+			return err
+		}
+
+		logrus.Warnf("telegram %s failed, retrying in %v: %v", method, delay, err)
+		metrics.TelegramRetries.WithLabelValues(method).Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			metrics.TelegramFailures.WithLabelValues(method).Inc()
+			return err
+		}
+	}
+}
+
+// wait blocks until the request is allowed by the limiters, failing if the context is done first
+// or would be done before.
+func (o *Outbound) wait(ctx context.Context, chatID int64) error {
+	if chatID != 0 {
+		if err := o.chatLimiter(chatID).Wait(ctx); err != nil {
+			return fmt.Errorf("chat limit: %w", err)
+		}
+	}
+	if err := o.global.Wait(ctx); err != nil {
+		return fmt.Errorf("global limit: %w", err)
+	}
+	return nil
+}
+
+func (o *Outbound) chatLimiter(chatID int64) *rate.Limiter {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	limiter, ok := o.chats[chatID]
+	if ok {
+		return limiter
+	}
+
+	if len(o.chats) >= maxChatLimiters {
+		// Full limiters are equivalent to new ones.
+		for id, l := range o.chats {
+			if l.Tokens() >= float64(l.Burst()) {
+				delete(o.chats, id)
+			}
+		}
+	}
+
+	limiter = rate.NewLimiter(rate.Inf, 0)
+	if o.opts.ChatRate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(o.opts.ChatRate/60), max(1, o.opts.ChatBurst))
+	}
+	o.chats[chatID] = limiter
+	return limiter
+}
+
+// retryDelay returns the delay before the next attempt, or false if the request shouldn't be retried.
+func (o *Outbound) retryDelay(method string, err error, attempt int) (time.Duration, bool) {
+	if attempt >= o.opts.MaxRetries {
+		return 0, false
+	}
+
+	var floodErr telebot.FloodError
+	if errors.As(err, &floodErr) {
+		delay := time.Duration(floodErr.RetryAfter) * time.Second
+		return delay, delay <= o.opts.MaxRetryWait
+	}
+
+	var netErr net.Error
+	switch code := errorCode(err); {
+	case code == http.StatusTooManyRequests:
+	case nonIdempotentMethods[method]:
+		if !notSent(err) {
+			return 0, false
+		}
+	case code >= 500 || errors.As(err, &netErr):
+	default:
+		return 0, false
+	}
+
+	delay := o.opts.RetryBackoff << attempt
+	delay += rand.N(delay/2 + 1)
+	return min(delay, o.opts.MaxRetryWait), true
+}
+
+// errorCode returns the code of the Bot API error, or 0 if unknown.
+// telebot only has typed errors for known descriptions, others are formatted as "telegram: description (code)".
+func errorCode(err error) int {
+	var apiErr *telebot.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	if m := errorCodeRe.FindStringSubmatch(err.Error()); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return code
+	}
+	return 0
+}
+
+// notSent reports whether the request failed before reaching Telegram, like on a refused connection.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func recipientID(to telebot.Recipient) int64 {
+	id, err := strconv.ParseInt(to.Recipient(), 10, 64)
+	if err != nil {
+		// Channel usernames are not limited per chat.
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,145 @@
+package tgutil_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgtest"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgutil"
+	"gopkg.in/telebot.v4"
+)
+
+func newOutbound(t *testing.T, opts tgutil.OutboundOptions) (*tgtest.Server, *tgutil.Outbound) {
+	t.Helper()
+
+	tg := tgtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	bot, err := tg.NewBot()
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+	return tg, tgutil.NewOutbound(context.Background(), bot, opts)
+}
+
+func TestOutboundRetriesFlood(t *testing.T) {
+	tg, outbound := newOutbound(t, tgutil.OutboundOptions{
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+		MaxRetryWait: 5 * time.Second,
+	})
+
+	tg.Fail("unbanChatMember", http.StatusTooManyRequests, 1)
+	tg.Fail("unbanChatMember", http.StatusBadGateway, 0)
+
+	start := time.Now()
+	if err := outbound.Unban(&telebot.Chat{ID: -1}, &telebot.User{ID: 42}); err != nil {
+		t.Fatalf("unban failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %v, want retry_after respected", elapsed)
+	}
+	if calls := tg.Calls("unbanChatMember"); len(calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(calls))
+	}
+}
+
+func TestOutboundDoesNotRetryPermanentErrors(t *testing.T) {
+	tg, outbound := newOutbound(t, tgutil.OutboundOptions{
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+		MaxRetryWait: time.Second,
+	})
+
+	tg.Fail("sendMessage", http.StatusForbidden, 0)
+	if _, err := outbound.Send(&telebot.User{ID: 42}, "hi"); err == nil {
+		t.Fatal("send succeeded, want an error")
+	}
+
+	// Waiting longer than allowed fails instantly.
+	tg.Fail("sendMessage", http.StatusTooManyRequests, 10)
+	_, err := outbound.Send(&telebot.User{ID: 42}, "hi")
+	var floodErr telebot.FloodError
+	if !errors.As(err, &floodErr) {
+		t.Fatalf("got %v, want a flood error", err)
+	}
+
+	if calls := tg.Calls("sendMessage"); len(calls) != 2 {
+		t.Fatalf("got %d calls, want 2", len(calls))
+	}
+}
+
+func TestOutboundLimitsChat(t *testing.T) {
+	tg, outbound := newOutbound(t, tgutil.OutboundOptions{
+		ChatRate:  600,
+		ChatBurst: 1,
+	})
+
+	start := time.Now()
+	for range 3 {
+		if _, err := outbound.Send(&telebot.Chat{ID: -1}, "hi"); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+	// The first message uses the burst, two more wait for 100ms each.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("sent 3 messages in %v, want throttling", elapsed)
+	}
+
+	if _, err := outbound.Send(&telebot.Chat{ID: -2}, "hi"); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if calls := tg.Calls("sendMessage"); len(calls) != 4 {
+		t.Fatalf("got %d calls, want 4", len(calls))
+	}
+}
+
+func TestOutboundDoesNotResendMessages(t *testing.T) {
+	tg, outbound := newOutbound(t, tgutil.OutboundOptions{
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+		MaxRetryWait: time.Second,
+	})
+
+	// The message may have been posted before the gateway failed.
+	tg.Fail("sendMessage", http.StatusBadGateway, 0)
+	if _, err := outbound.Send(&telebot.User{ID: 42}, "hi"); err == nil {
+		t.Fatal("send succeeded, want an error")
+	}
+	if calls := tg.Calls("sendMessage"); len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(calls))
+	}
+}
+
+func TestOutboundWaitIsCancelled(t *testing.T) {
+	tg := tgtest.NewServer()
+	t.Cleanup(tg.Close)
+
+	bot, err := tg.NewBot()
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	outbound := tgutil.NewOutbound(ctx, bot, tgutil.OutboundOptions{
+		ChatRate:  1,
+		ChatBurst: 1,
+	})
+
+	if _, err := outbound.Send(&telebot.Chat{ID: -1}, "hi"); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	// The next message would wait for a minute.
+	cancel()
+	start := time.Now()
+	if _, err := outbound.Send(&telebot.Chat{ID: -1}, "hi"); err == nil {
+		t.Fatal("send succeeded, want an error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("send returned after %v, want the wait cancelled", elapsed)
+	}
+}
@@ -0,0 +1,54 @@
+package tgutil
+
+import (
+	"fmt"
+
+	"gopkg.in/telebot.v4"
+)
+
+// CanRestrict reports whether the bot may restrict members of the chat.
+// Unknown membership (not synced yet) is optimistically treated as allowed.
+func CanRestrict(botMember *telebot.ChatMember) bool {
+	return botMember == nil || botMember.CanRestrictMembers
+}
+
+// RestrictMember forbids the user from sending anything to the chat until unrestricted.
+func RestrictMember(bot telebot.API, chatID, userID int64) error {
+	if err := bot.Restrict(
+		&telebot.Chat{ID: chatID},
+		&telebot.ChatMember{
+			User:   &telebot.User{ID: userID},
+			Rights: telebot.NoRights(),
+		},
+	); err != nil {
+		return fmt.Errorf("restricting member: %w", err)
+	}
+	return nil
+}
+
+// UnrestrictMember lifts restrictions set by RestrictMember, restoring the default permissions of the chat
+// so the member doesn't get rights the chat denies to everyone.
+func UnrestrictMember(bot telebot.API, chatID, userID int64) error {
+	chat, err := bot.ChatByID(chatID)
+	if err != nil {
+		return fmt.Errorf("getting chat: %w", err)
+	}
+	if chat.Permissions == nil {
+		return fmt.Errorf("chat %d has no default permissions", chatID)
+	}
+
+	rights := *chat.Permissions
+	// The chat permissions are granular, apply them as they are.
+	rights.Independent = true
+
+	if err := bot.Restrict(
+		&telebot.Chat{ID: chatID},
+		&telebot.ChatMember{
+			User:   &telebot.User{ID: userID},
+			Rights: rights,
+		},
+	); err != nil {
+		return fmt.Errorf("unrestricting member: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package tgutil_test
+
+import (
+	"testing"
+
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgtest"
+	"github.com/C4T-BuT-S4D/shpaga/internal/tgutil"
+	"gopkg.in/telebot.v4"
+)
+
+func TestUnrestrictMemberRestoresChatPermissions(t *testing.T) {
+	tg := tgtest.NewServer()
+	defer tg.Close()
+
+	bot, err := tg.NewBot()
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+
+	// A text-only chat.
+	tg.SetChatPermissions(-1, telebot.Rights{CanSendMessages: true})
+
+	if err := tgutil.UnrestrictMember(bot, -1, 42); err != nil {
+		t.Fatalf("unrestricting member: %v", err)
+	}
+
+	call := tg.Calls("restrictChatMember")[0]
+	var rights telebot.Rights
+	if err := call.Decode("permissions", &rights); err != nil {
+		t.Fatalf("decoding permissions: %v", err)
+	}
+	if !rights.CanSendMessages || rights.CanSendPhotos || rights.CanSendPolls {
+		t.Fatalf("unexpected permissions %+v", rights)
+	}
+	if call.Param("use_independent_chat_permissions") != "true" {
+		t.Fatalf("permissions are not independent: %+v", call.Params)
+	}
+}
@@ -0,0 +1,127 @@
+package tgutil
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookPoller receives updates from Telegram on its own HTTP listener.
+// Unlike telebot.Webhook, it answers requests with a wrong secret token with 401
+// and doesn't block on updates arriving after the bot is stopped.
+type WebhookPoller struct {
+	// Listen is the local address of the listener.
+	Listen string
+	// PublicURL is the address Telegram sends updates to, usually a reverse proxy.
+	PublicURL string
+	// SecretToken is expected in the X-Telegram-Bot-Api-Secret-Token header.
+	SecretToken string
+	// CertFile and KeyFile enable TLS on the listener.
+	CertFile string
+	KeyFile  string
+	// UploadCert sends CertFile to Telegram, required for self-signed certificates.
+	UploadCert bool
+
+	AllowedUpdates []string
+}
+
+// Register calls setWebhook, must be done before the bot is started.
+func (p *WebhookPoller) Register(bot *telebot.Bot) error {
+	webhook := &telebot.Webhook{
+		AllowedUpdates: p.AllowedUpdates,
+		SecretToken:    p.SecretToken,
+		Endpoint:       &telebot.WebhookEndpoint{PublicURL: p.PublicURL},
+	}
+	if p.UploadCert {
+		webhook.Endpoint.Cert = p.CertFile
+	}
+	if err := bot.SetWebhook(webhook); err != nil {
+		return fmt.Errorf("setting webhook: %w", err)
+	}
+	return nil
+}
+
+// Unregister calls deleteWebhook, pending updates are kept.
+func (p *WebhookPoller) Unregister(bot *telebot.Bot) error {
+	if err := bot.RemoveWebhook(); err != nil {
+		return fmt.Errorf("removing webhook: %w", err)
+	}
+	return nil
+}
+
+func (p *WebhookPoller) Poll(_ *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	server := &http.Server{
+		Addr:              p.Listen,
+		Handler:           p.handler(dest, stop),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var err error
+		if p.CertFile != "" && p.KeyFile != "" {
+			err = server.ListenAndServeTLS(p.CertFile, p.KeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("webhook server failed: %v", err)
+		}
+	}()
+
+	logrus.Infof("listening for webhook updates on %s", p.Listen)
+
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.Errorf("shutting down webhook server: %v", err)
+	}
+	<-done
+}
+
+func (p *WebhookPoller) handler(dest chan<- telebot.Update, stop <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get(secretTokenHeader)
+		if p.SecretToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.SecretToken)) != 1 {
+			logrus.Warnf("webhook request from %s with invalid secret token", r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var update telebot.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			logrus.Warnf("decoding webhook update: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case dest <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-stop:
+			// Telegram will redeliver the update.
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
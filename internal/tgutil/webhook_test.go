@@ -0,0 +1,66 @@
+package tgutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/telebot.v4"
+)
+
+func webhookRequest(method, secret, body string) *http.Request {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set(secretTokenHeader, secret)
+	}
+	return req
+}
+
+func TestWebhookHandler(t *testing.T) {
+	poller := &WebhookPoller{SecretToken: "secret"}
+	dest := make(chan telebot.Update, 1)
+	handler := poller.handler(dest, make(chan struct{}))
+
+	for _, tc := range []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{name: "wrong method", req: webhookRequest(http.MethodGet, "secret", ""), want: http.StatusMethodNotAllowed},
+		{name: "missing secret", req: webhookRequest(http.MethodPost, "", `{"update_id": 1}`), want: http.StatusUnauthorized},
+		{name: "wrong secret", req: webhookRequest(http.MethodPost, "guess", `{"update_id": 1}`), want: http.StatusUnauthorized},
+		{name: "bad body", req: webhookRequest(http.MethodPost, "secret", "{"), want: http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, tc.req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+	if len(dest) != 0 {
+		t.Fatalf("rejected requests delivered updates")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, webhookRequest(http.MethodPost, "secret", `{"update_id": 7}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", rec.Code)
+	}
+	if update := <-dest; update.ID != 7 {
+		t.Fatalf("delivered update %d, want 7", update.ID)
+	}
+}
+
+func TestWebhookHandlerAfterStop(t *testing.T) {
+	poller := &WebhookPoller{}
+	stop := make(chan struct{})
+	close(stop)
+
+	// Nobody reads the updates after the bot is stopped, Telegram redelivers them later.
+	rec := httptest.NewRecorder()
+	poller.handler(make(chan telebot.Update), stop).ServeHTTP(rec, webhookRequest(http.MethodPost, "", `{"update_id": 1}`))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503", rec.Code)
+	}
+}